@@ -6,18 +6,30 @@ import (
 	sync_proto "github.com/Gregmus2/sync-proto-gen/go/sync"
 	"github.com/Gregmus2/sync-service/internal/adapters"
 	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/Gregmus2/sync-service/internal/groupproto"
 	interceptors2 "github.com/Gregmus2/sync-service/internal/interceptors"
 	"github.com/Gregmus2/sync-service/internal/logic"
 	"github.com/Gregmus2/sync-service/internal/presenters"
+	"github.com/sirupsen/logrus"
 	"go.uber.org/fx"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(os.Args[2:]); err != nil {
+			logrus.WithError(err).Fatal("failed to migrate")
+		}
+
+		return
+	}
+
 	core.Serve(
 		[]core.Server{
 			{
 				Services: []core.Service{
 					{ServiceDesc: sync_proto.SyncService_ServiceDesc, Constructor: presenters.NewAPI},
+					{ServiceDesc: groupproto.GroupService_ServiceDesc, Constructor: presenters.NewGroupAPI},
 				},
 				Interceptors: []interceptors.Interceptor{
 					&interceptors.ErrorHandlingInterceptor{},
@@ -31,14 +43,31 @@ func main() {
 		fx.Provide(
 			common.NewConfig,
 			adapters.NewDB,
+			adapters.NewReplicaID,
 			adapters.NewRepository,
+			adapters.NewMigrator,
 			adapters.NewFirebaseApp,
 			adapters.NewFirebaseClient,
+			adapters.NewAdvisoryLock,
+			adapters.NewListener,
+			adapters.NewNotifier,
 			logic.NewGroupMutex,
 			logic.NewService,
 			logic.NewWorkerPool,
+			logic.NewHub,
+			logic.NewClock,
+			logic.NewGroupNotifier,
+			logic.NewCompactor,
+			logic.NewRetention,
+			logic.NewGroupCleaner,
 			presenters.NewErrorMapping,
 			presenters.NewValidator,
 		),
+		fx.Invoke(migrateOnStart),
+		fx.Invoke(logic.ScheduleCompaction),
+		fx.Invoke(logic.ScheduleRetention),
+		fx.Invoke(logic.ScheduleGroupCleanup),
+		fx.Invoke(logic.ListenForCommits),
+		fx.Invoke(logic.ReportGroupMutexSize),
 	)
 }
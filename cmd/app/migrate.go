@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"strconv"
+)
+
+// migrate runs "migrate [up]" or "migrate down [steps]" without starting the server.
+func migrate(args []string) error {
+	cfg, err := common.NewConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to read config")
+	}
+
+	db, err := adapters.NewDB(cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to database")
+	}
+
+	m, err := adapters.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return errors.Errorf("database driver %s has no migrations", cfg.DatabaseDriver)
+	}
+
+	if len(args) == 0 || args[0] == "up" {
+		return m.Up()
+	}
+
+	if args[0] != "down" {
+		return errors.Errorf("unknown migrate command %s", args[0])
+	}
+
+	steps := 1
+	if len(args) > 1 {
+		steps, err = strconv.Atoi(args[1])
+		if err != nil {
+			return errors.Wrap(err, "invalid number of steps")
+		}
+	}
+
+	return m.Down(steps)
+}
+
+// migrateOnStart applies pending migrations before the server accepts requests. Without MigrateOnStart the schema
+// must be migrated already, queries rely on its indexes, e.g. uploads are deduplicated by the unique index on
+// (group_id, client_operation_id).
+func migrateOnStart(cfg *common.Config, m adapters.Migrator) error {
+	if m == nil {
+		return nil
+	}
+	if cfg.MigrateOnStart {
+		return m.Up()
+	}
+
+	pending, err := m.Pending()
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return errors.Errorf("database schema is %d migrations behind, run migrate", pending)
+	}
+
+	return nil
+}
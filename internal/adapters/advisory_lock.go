@@ -0,0 +1,124 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"hash/fnv"
+	"sync"
+)
+
+// advisoryLock holds postgres session-level advisory locks. Every held key owns a dedicated
+// connection, because the lock belongs to the session that acquired it.
+type advisoryLock struct {
+	db *sql.DB
+
+	mx    sync.Mutex
+	conns map[string]*sql.Conn
+}
+
+func NewAdvisoryLock(db *gorm.DB) (AdvisoryLock, error) {
+	if db == nil {
+		// the memory driver has no database to lock in
+		return nil, nil
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get sql db")
+	}
+
+	return &advisoryLock{
+		db:    sqlDB,
+		conns: make(map[string]*sql.Conn),
+	}, nil
+}
+
+func (l *advisoryLock) Lock(ctx context.Context, key string) error {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get connection")
+	}
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID(key))
+	if err != nil {
+		// a cancelled query may still have taken the lock, dropping the session releases it
+		discard(conn)
+
+		return errors.Wrap(err, "failed to acquire advisory lock")
+	}
+
+	l.hold(key, conn)
+
+	return nil
+}
+
+func (l *advisoryLock) TryLock(key string) (bool, error) {
+	conn, err := l.db.Conn(context.Background())
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get connection")
+	}
+
+	var locked bool
+	err = conn.QueryRowContext(context.Background(), `SELECT pg_try_advisory_lock($1)`, lockID(key)).Scan(&locked)
+	if err != nil {
+		discard(conn)
+
+		return false, errors.Wrap(err, "failed to try advisory lock")
+	}
+	if !locked {
+		return false, conn.Close()
+	}
+
+	l.hold(key, conn)
+
+	return true, nil
+}
+
+func (l *advisoryLock) Unlock(key string) error {
+	l.mx.Lock()
+	conn, ok := l.conns[key]
+	delete(l.conns, key)
+	l.mx.Unlock()
+
+	if !ok {
+		return errors.Errorf("advisory lock %s is not held", key)
+	}
+
+	_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID(key))
+	if err != nil {
+		discard(conn)
+
+		return errors.Wrap(err, "failed to release advisory lock")
+	}
+
+	return conn.Close()
+}
+
+func (l *advisoryLock) Size() int {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	return len(l.conns)
+}
+
+func (l *advisoryLock) hold(key string, conn *sql.Conn) {
+	l.mx.Lock()
+	l.conns[key] = conn
+	l.mx.Unlock()
+}
+
+// discard closes the session instead of returning it to the pool, so locks it may hold don't leak.
+func discard(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+}
+
+// lockID maps a key onto the bigint key space of pg_advisory_lock.
+func lockID(key string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+
+	return int64(h.Sum64())
+}
@@ -0,0 +1,64 @@
+package adapters
+
+import (
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r repository) GetFieldWrite(groupID, entityName, entityID, field string) (*common.FieldWrite, error) {
+	write := &common.FieldWrite{}
+	err := r.client.Where(
+		"group_id = ? AND entity_name = ? AND entity_id = ? AND field = ?", groupID, entityName, entityID, field,
+	).Take(write).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select field write")
+	}
+
+	return write, nil
+}
+
+func (r repository) SaveFieldWrite(write *common.FieldWrite) error {
+	err := r.client.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "group_id"}, {Name: "entity_name"}, {Name: "entity_id"}, {Name: "field"}},
+		DoUpdates: clause.AssignmentColumns([]string{"timestamp", "value"}),
+	}).Create(write).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to save field write")
+	}
+
+	return nil
+}
+
+func (r repository) RemoveFieldWrites(groupID, entityName, entityID string) error {
+	err := r.client.Exec(
+		`DELETE FROM field_writes WHERE group_id = ? AND entity_name = ? AND entity_id = ?`, groupID, entityName, entityID,
+	).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to remove field writes")
+	}
+
+	return nil
+}
+
+// mergeFieldWrites copies field writes of a group into another one, where the newer write of a field wins.
+func mergeFieldWrites(tx *gorm.DB, fromID, toID string) error {
+	err := tx.Exec(
+		`INSERT INTO field_writes (group_id, entity_name, entity_id, field, timestamp, value)
+				SELECT ?, entity_name, entity_id, field, timestamp, value FROM field_writes WHERE group_id = ?
+				ON CONFLICT (group_id, entity_name, entity_id, field) DO UPDATE
+				SET timestamp = excluded.timestamp, value = excluded.value
+				WHERE excluded.timestamp > field_writes.timestamp
+				   OR (excluded.timestamp = field_writes.timestamp AND excluded.value > field_writes.value)`,
+		toID, fromID,
+	).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to merge field writes")
+	}
+
+	return nil
+}
@@ -1,19 +1,105 @@
 package adapters
 
 import (
+	"context"
 	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
+	"github.com/Gregmus2/sync-service/internal/common"
 )
 
 type Repository interface {
-	UpdateDeviceTokenTime(deviceToken, userID, groupID string) error
-	InsertData(deviceToken, groupID string, operation []*proto.Operation) error
+	// WithTx runs fn with a repository bound to a single transaction, which is committed if fn returns nil
+	WithTx(fn func(repo Repository) error) error
+	// UpdateDeviceCursor moves the device cursor to the last operation of the group and returns it
+	UpdateDeviceCursor(deviceToken, userID, groupID string) (int64, error)
+	// AdvanceDeviceCursor moves the device cursor to the given id unless it is past it already
+	AdvanceDeviceCursor(deviceToken string, cursor int64) error
+	// InsertData stores every operation with the hybrid logical clock timestamp at the same index of stamps and
+	// returns acknowledgements with the server sequence of every operation that has a client id
+	InsertData(deviceToken, groupID string, operation []*proto.Operation, stamps []int64) ([]*proto.OperationAck, error)
+	// GetOperationID returns the server sequence of the operation with the client id in the group, zero if there is
+	// none
+	GetOperationID(groupID, clientOperationID string) (int64, error)
 	CleanConflicted(deviceToken, groupID string) error
 	GetGroupID(deviceToken, userID string) (string, error)
-	GetData(deviceToken, groupID string) ([]*proto.SimpleOperation, error)
+	// GetData returns operations of the group after the device cursor uploaded by other devices, ordered by their
+	// hybrid logical clock timestamps
+	GetData(deviceToken, groupID string) ([]common.LoggedOperation, error)
 	UpdateGroupID(userID, newGroupID string) error
 	MigrateData(fromID, toID string) error
 	RemoveData(groupID string) error
-	GetAllData(groupID string) ([]*proto.SimpleOperation, error)
-	CopyOperations(fromID, toID string) error
+	GetAllData(groupID string) ([]common.LoggedOperation, error)
+	// CopyOperations also merges field writes, where the newer write of a field wins. It returns the copies made,
+	// operations the target group has already are not copied
+	CopyOperations(fromID, toID string) ([]common.CopiedOperation, error)
+	// IsGroupExists is true for groups with devices and abandoned groups waiting for deletion
 	IsGroupExists(groupID string) (bool, error)
+	// GetCursor returns the device cursor, zero for devices that never synced
+	GetCursor(deviceToken string) (int64, error)
+	// GetLog returns operations of the group after the given id with their related entities
+	GetLog(groupID string, after int64) ([]common.LoggedOperation, error)
+	// GetSnapshot returns nil if the group was never compacted
+	GetSnapshot(groupID string) (*common.Snapshot, error)
+	SaveSnapshot(snapshot *common.Snapshot) error
+	// GetGroupsToCompact returns groups with at least threshold operations after their snapshot
+	GetGroupsToCompact(threshold int) ([]string, error)
+	// GetMaxHLC returns the latest hybrid logical clock timestamp of the group operations
+	GetMaxHLC(groupID string) (int64, error)
+	// GetMaxCursor returns the cursor of the group device that synced furthest
+	GetMaxCursor(groupID string) (int64, error)
+	RemoveOperations(ids []int) error
+	GetGroupDevices(groupID string) ([]common.DeviceToken, error)
+	// PruneData removes operations of the group up to the given id, which must be covered by the group snapshot
+	PruneData(groupID string, upTo int64) error
+	// GetGroupsToPrune returns groups with operations covered by their snapshot
+	GetGroupsToPrune() ([]string, error)
+	// MarkGroupAbandoned keeps the time of the first mark
+	MarkGroupAbandoned(groupID string, at int64) error
+	UnmarkGroupAbandoned(groupID string) error
+	// GetAbandonedGroups returns groups abandoned before the given time
+	GetAbandonedGroups(before int64) ([]string, error)
+	CreateInvite(invite *common.Invite) error
+	// GetInvite returns nil if there is no invite with the code
+	GetInvite(code string) (*common.Invite, error)
+	GetInvites(groupID string) ([]common.Invite, error)
+	RemoveInvite(code string) error
+	RemoveExpiredInvites(before int64) error
+	// GetMember returns nil if the user has no member record in the group
+	GetMember(groupID, userID string) (*common.Member, error)
+	// SaveMember creates the member or changes the role of an existing one
+	SaveMember(member *common.Member) error
+	RemoveMember(groupID, userID string) error
+	GetMembers(groupID string) ([]common.Member, error)
+	// GetFieldWrite returns nil if the field was never written by a structured operation
+	GetFieldWrite(groupID, entityName, entityID, field string) (*common.FieldWrite, error)
+	SaveFieldWrite(write *common.FieldWrite) error
+	// RemoveFieldWrites forgets all fields of the entity
+	RemoveFieldWrites(groupID, entityName, entityID string) error
+}
+
+// Listener receives notifications about operations committed by any replica sharing the database
+type Listener interface {
+	// Listen calls fn with the group and the uploading device of every commit until ctx is done or the connection
+	// fails, the device token is empty for operations copied from another group
+	Listen(ctx context.Context, fn func(groupID, deviceToken string)) error
+}
+
+// Notifier wakes up devices, so they sync the changes of their group in the background
+type Notifier interface {
+	Notify(ctx context.Context, groupID string, deviceTokens []string) error
+}
+
+type AdvisoryLock interface {
+	Lock(ctx context.Context, key string) error
+	TryLock(key string) (bool, error)
+	Unlock(key string) error
+	Size() int
+}
+
+type Migrator interface {
+	// Up applies every pending migration
+	Up() error
+	// Down reverts the given number of the latest applied migrations
+	Down(steps int) error
+	// Pending returns the number of migrations not applied yet
+	Pending() (int, error)
 }
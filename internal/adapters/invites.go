@@ -0,0 +1,54 @@
+package adapters
+
+import (
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+func (r repository) CreateInvite(invite *common.Invite) error {
+	if err := r.client.Create(invite).Error; err != nil {
+		return errors.Wrap(err, "failed to create invite")
+	}
+
+	return nil
+}
+
+func (r repository) GetInvite(code string) (*common.Invite, error) {
+	invite := &common.Invite{}
+	err := r.client.Where("code = ?", code).Take(invite).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select invite")
+	}
+
+	return invite, nil
+}
+
+func (r repository) GetInvites(groupID string) ([]common.Invite, error) {
+	invites := make([]common.Invite, 0)
+	err := r.client.Where("group_id = ?", groupID).Order("created_at").Find(&invites).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select invites")
+	}
+
+	return invites, nil
+}
+
+func (r repository) RemoveInvite(code string) error {
+	if err := r.client.Exec(`DELETE FROM invites WHERE code = ?`, code).Error; err != nil {
+		return errors.Wrap(err, "failed to remove invite")
+	}
+
+	return nil
+}
+
+func (r repository) RemoveExpiredInvites(before int64) error {
+	if err := r.client.Exec(`DELETE FROM invites WHERE expires_at < ?`, before).Error; err != nil {
+		return errors.Wrap(err, "failed to remove expired invites")
+	}
+
+	return nil
+}
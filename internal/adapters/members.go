@@ -0,0 +1,52 @@
+package adapters
+
+import (
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r repository) GetMember(groupID, userID string) (*common.Member, error) {
+	member := &common.Member{}
+	err := r.client.Table("group_members").Where("group_id = ? AND user_id = ?", groupID, userID).Take(member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select member")
+	}
+
+	return member, nil
+}
+
+func (r repository) SaveMember(member *common.Member) error {
+	err := r.client.Table("group_members").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "group_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}).Create(member).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to save member")
+	}
+
+	return nil
+}
+
+func (r repository) RemoveMember(groupID, userID string) error {
+	err := r.client.Exec(`DELETE FROM group_members WHERE group_id = ? AND user_id = ?`, groupID, userID).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to remove member")
+	}
+
+	return nil
+}
+
+func (r repository) GetMembers(groupID string) ([]common.Member, error) {
+	members := make([]common.Member, 0)
+	err := r.client.Table("group_members").Where("group_id = ?", groupID).Order("joined_at").Find(&members).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select members")
+	}
+
+	return members, nil
+}
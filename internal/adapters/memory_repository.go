@@ -0,0 +1,821 @@
+package adapters
+
+import (
+	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const operationDelete = "OPERATION_DELETE"
+
+// memoryRepository keeps everything in process memory. It mirrors the semantics of the sql repository,
+// so it can replace the database in tests and ephemeral deployments.
+type memoryRepository struct {
+	mx    *sync.RWMutex
+	state *memoryState
+	// inTx is set for repositories passed to WithTx, they already hold the write lock
+	inTx bool
+}
+
+type memoryState struct {
+	lastID int
+	// operations are ordered by id and never changed after insert, so a state copy can share them
+	operations []*memoryOperation
+	devices    map[string]common.DeviceToken
+	snapshots  map[string]*common.Snapshot
+	// abandoned keeps the time groups lost their last device
+	abandoned map[string]int64
+	invites   map[string]common.Invite
+	members   map[memberKey]common.Member
+	writes    map[fieldKey]common.FieldWrite
+}
+
+type memberKey struct {
+	groupID string
+	userID  string
+}
+
+type fieldKey struct {
+	groupID    string
+	entityName string
+	entityID   string
+	field      string
+}
+
+type memoryOperation struct {
+	common.Operation
+	entities []common.RelatedEntity
+}
+
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		mx: &sync.RWMutex{},
+		state: &memoryState{
+			operations: make([]*memoryOperation, 0),
+			devices:    make(map[string]common.DeviceToken),
+			snapshots:  make(map[string]*common.Snapshot),
+			abandoned:  make(map[string]int64),
+			invites:    make(map[string]common.Invite),
+			members:    make(map[memberKey]common.Member),
+			writes:     make(map[fieldKey]common.FieldWrite),
+		},
+	}
+}
+
+// WithTx works on a copy of the state and replaces the original with it only if fn succeeds.
+func (r *memoryRepository) WithTx(fn func(repo Repository) error) error {
+	if !r.inTx {
+		r.mx.Lock()
+		defer r.mx.Unlock()
+	}
+
+	tx := &memoryRepository{
+		mx:    r.mx,
+		state: r.state.clone(),
+		inTx:  true,
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	*r.state = *tx.state
+
+	return nil
+}
+
+func (r *memoryRepository) UpdateDeviceCursor(deviceToken, userID, groupID string) (int64, error) {
+	var cursor int64
+	err := r.write(func(s *memoryState) error {
+		for _, op := range s.operations {
+			if op.GroupId == groupID {
+				cursor = int64(op.ID)
+			}
+		}
+
+		s.devices[deviceToken] = common.DeviceToken{
+			DeviceToken:     deviceToken,
+			UserId:          userID,
+			GroupId:         groupID,
+			LastSync:        time.Now().UnixMicro(),
+			LastOperationId: cursor,
+		}
+
+		return nil
+	})
+
+	return cursor, err
+}
+
+func (r *memoryRepository) AdvanceDeviceCursor(deviceToken string, cursor int64) error {
+	return r.write(func(s *memoryState) error {
+		device, ok := s.devices[deviceToken]
+		if ok && device.LastOperationId < cursor {
+			device.LastOperationId = cursor
+			s.devices[deviceToken] = device
+		}
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) InsertData(deviceToken, groupID string, operations []*proto.Operation, stamps []int64) ([]*proto.OperationAck, error) {
+	acks := make([]*proto.OperationAck, 0, len(operations))
+	err := r.write(func(s *memoryState) error {
+		for i, op := range operations {
+			if op.Id != "" {
+				if existing := s.findByClientID(groupID, op.Id); existing != nil {
+					acks = append(acks, &proto.OperationAck{Id: op.Id, Sequence: int64(existing.ID)})
+
+					continue
+				}
+			}
+
+			entities := make([]common.RelatedEntity, 0, len(op.RelatedEntities))
+			for _, entity := range op.RelatedEntities {
+				entities = append(entities, common.RelatedEntity{EntityID: entity.Id, EntityName: entity.Name})
+			}
+
+			inserted := s.insert(common.Operation{
+				ClientOperationId: clientOperationID(op),
+				DeviceToken:       deviceToken,
+				GroupId:           groupID,
+				OperationType:     op.Type.String(),
+				Sql:               op.Sql,
+				Args:              op.Args,
+				CreatedAt:         time.Now().UnixMicro(),
+				HLC:               stamps[i],
+			}, entities)
+			if op.Id != "" {
+				acks = append(acks, &proto.OperationAck{Id: op.Id, Sequence: int64(inserted.ID)})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return acks, nil
+}
+
+func (r *memoryRepository) GetOperationID(groupID, clientOperationID string) (int64, error) {
+	var id int64
+	r.read(func(s *memoryState) {
+		if op := s.findByClientID(groupID, clientOperationID); op != nil {
+			id = int64(op.ID)
+		}
+	})
+
+	return id, nil
+}
+
+// CleanConflicted removes operations after the device cursor that touch an entity deleted by an earlier operation.
+func (r *memoryRepository) CleanConflicted(deviceToken, groupID string) error {
+	return r.write(func(s *memoryState) error {
+		cursor := s.devices[deviceToken].LastOperationId
+		deleted := make(map[common.RelatedEntity]struct{})
+		conflicted := make(map[int]struct{})
+		for _, op := range s.operations {
+			if op.GroupId != groupID {
+				continue
+			}
+
+			for _, entity := range op.entities {
+				key := common.RelatedEntity{EntityID: entity.EntityID, EntityName: entity.EntityName}
+				if _, ok := deleted[key]; ok && int64(op.ID) > cursor {
+					conflicted[op.ID] = struct{}{}
+				}
+			}
+
+			if op.OperationType == operationDelete {
+				for _, entity := range op.entities {
+					deleted[common.RelatedEntity{EntityID: entity.EntityID, EntityName: entity.EntityName}] = struct{}{}
+				}
+			}
+		}
+
+		s.remove(func(op *memoryOperation) bool {
+			_, ok := conflicted[op.ID]
+
+			return ok
+		})
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) GetGroupID(deviceToken, userID string) (string, error) {
+	var groupID string
+	r.read(func(s *memoryState) {
+		groupID = s.devices[deviceToken].GroupId
+	})
+
+	if groupID == "" {
+		// return user id if group id is not set to keep user in own group
+		return userID, nil
+	}
+
+	return groupID, nil
+}
+
+func (r *memoryRepository) GetData(deviceToken, groupID string) ([]common.LoggedOperation, error) {
+	var operations []common.LoggedOperation
+	r.read(func(s *memoryState) {
+		cursor := s.devices[deviceToken].LastOperationId
+		operations = s.log(func(op *memoryOperation) bool {
+			return op.GroupId == groupID && op.DeviceToken != deviceToken && int64(op.ID) > cursor
+		})
+	})
+	// the log is ordered by id, which breaks ties of the clock
+	sort.SliceStable(operations, func(i, j int) bool { return operations[i].HLC < operations[j].HLC })
+
+	return operations, nil
+}
+
+func (r *memoryRepository) UpdateGroupID(userID, newGroupID string) error {
+	return r.write(func(s *memoryState) error {
+		for token, device := range s.devices {
+			if device.UserId == userID {
+				device.GroupId = newGroupID
+				s.devices[token] = device
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) MigrateData(fromID, toID string) error {
+	return r.WithTx(func(repo Repository) error {
+		if _, err := repo.CopyOperations(fromID, toID); err != nil {
+			return err
+		}
+
+		return repo.RemoveData(fromID)
+	})
+}
+
+func (r *memoryRepository) RemoveData(groupID string) error {
+	return r.write(func(s *memoryState) error {
+		s.remove(func(op *memoryOperation) bool {
+			return op.GroupId == groupID
+		})
+		delete(s.snapshots, groupID)
+		delete(s.abandoned, groupID)
+		for code, invite := range s.invites {
+			if invite.GroupId == groupID {
+				delete(s.invites, code)
+			}
+		}
+		for key := range s.members {
+			if key.groupID == groupID {
+				delete(s.members, key)
+			}
+		}
+		for key := range s.writes {
+			if key.groupID == groupID {
+				delete(s.writes, key)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) GetAllData(groupID string) ([]common.LoggedOperation, error) {
+	var operations []common.LoggedOperation
+	r.read(func(s *memoryState) {
+		operations = s.log(func(op *memoryOperation) bool {
+			return op.GroupId == groupID
+		})
+	})
+
+	return operations, nil
+}
+
+func (r *memoryRepository) CopyOperations(fromID, toID string) ([]common.CopiedOperation, error) {
+	copied := make([]common.CopiedOperation, 0)
+	err := r.write(func(s *memoryState) error {
+		// pruned operations exist only in the snapshot, it replaces the log up to its watermark
+		var after int64
+		if snapshot := s.snapshots[fromID]; snapshot != nil && snapshot.PrunedUpTo > 0 {
+			after = snapshot.Watermark
+			for _, op := range snapshot.Operations {
+				inserted := s.insert(common.Operation{
+					GroupId:       toID,
+					OperationType: op.OperationType,
+					Sql:           op.Sql,
+					Args:          op.Args,
+					CreatedAt:     snapshot.CreatedAt,
+					HLC:           op.HLC,
+				}, op.Entities)
+				copied = append(copied, common.CopiedOperation{FromID: int64(op.ID), ToID: int64(inserted.ID)})
+			}
+		}
+
+		source := make([]*memoryOperation, 0)
+		for _, op := range s.operations {
+			if op.GroupId == fromID && int64(op.ID) > after {
+				source = append(source, op)
+			}
+		}
+
+		for _, op := range source {
+			if op.ClientOperationId != nil && s.findByClientID(toID, *op.ClientOperationId) != nil {
+				continue
+			}
+
+			operation := op.Operation
+			operation.GroupId = toID
+			inserted := s.insert(operation, op.entities)
+			copied = append(copied, common.CopiedOperation{FromID: int64(op.ID), ToID: int64(inserted.ID)})
+		}
+
+		for key, write := range s.writes {
+			if key.groupID != fromID {
+				continue
+			}
+
+			key.groupID = toID
+			write.GroupId = toID
+			if existing, ok := s.writes[key]; !ok || newerWrite(write, existing) {
+				s.writes[key] = write
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return copied, nil
+}
+
+func (r *memoryRepository) IsGroupExists(groupID string) (bool, error) {
+	exists := false
+	r.read(func(s *memoryState) {
+		if _, ok := s.abandoned[groupID]; ok {
+			exists = true
+
+			return
+		}
+
+		for _, device := range s.devices {
+			if device.GroupId == groupID {
+				exists = true
+
+				return
+			}
+		}
+	})
+
+	return exists, nil
+}
+
+func (r *memoryRepository) GetCursor(deviceToken string) (int64, error) {
+	var cursor int64
+	r.read(func(s *memoryState) {
+		cursor = s.devices[deviceToken].LastOperationId
+	})
+
+	return cursor, nil
+}
+
+func (r *memoryRepository) GetLog(groupID string, after int64) ([]common.LoggedOperation, error) {
+	var operations []common.LoggedOperation
+	r.read(func(s *memoryState) {
+		operations = s.log(func(op *memoryOperation) bool {
+			return op.GroupId == groupID && int64(op.ID) > after
+		})
+	})
+
+	return operations, nil
+}
+
+func (r *memoryRepository) GetSnapshot(groupID string) (*common.Snapshot, error) {
+	var snapshot *common.Snapshot
+	r.read(func(s *memoryState) {
+		snapshot = s.snapshots[groupID]
+	})
+
+	return snapshot, nil
+}
+
+func (r *memoryRepository) SaveSnapshot(snapshot *common.Snapshot) error {
+	return r.write(func(s *memoryState) error {
+		saved := *snapshot
+		// pruned_up_to is moved by PruneData only
+		if existing, ok := s.snapshots[snapshot.GroupId]; ok {
+			saved.PrunedUpTo = existing.PrunedUpTo
+		}
+		s.snapshots[snapshot.GroupId] = &saved
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) PruneData(groupID string, upTo int64) error {
+	return r.write(func(s *memoryState) error {
+		s.remove(func(op *memoryOperation) bool {
+			return op.GroupId == groupID && int64(op.ID) <= upTo
+		})
+
+		if snapshot, ok := s.snapshots[groupID]; ok {
+			pruned := *snapshot
+			pruned.PrunedUpTo = upTo
+			s.snapshots[groupID] = &pruned
+		}
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) GetGroupsToPrune() ([]string, error) {
+	groups := make([]string, 0)
+	r.read(func(s *memoryState) {
+		for groupID, snapshot := range s.snapshots {
+			for _, op := range s.operations {
+				if op.GroupId == groupID && int64(op.ID) <= snapshot.Watermark {
+					groups = append(groups, groupID)
+
+					break
+				}
+			}
+		}
+	})
+
+	return groups, nil
+}
+
+func (r *memoryRepository) GetGroupsToCompact(threshold int) ([]string, error) {
+	groups := make([]string, 0)
+	r.read(func(s *memoryState) {
+		counts := make(map[string]int)
+		for _, op := range s.operations {
+			snapshot, ok := s.snapshots[op.GroupId]
+			if !ok || int64(op.ID) > snapshot.Watermark {
+				counts[op.GroupId]++
+			}
+		}
+
+		for groupID, count := range counts {
+			if count >= threshold {
+				groups = append(groups, groupID)
+			}
+		}
+	})
+
+	return groups, nil
+}
+
+func (r *memoryRepository) GetGroupDevices(groupID string) ([]common.DeviceToken, error) {
+	devices := make([]common.DeviceToken, 0)
+	r.read(func(s *memoryState) {
+		for _, device := range s.devices {
+			if device.GroupId == groupID {
+				devices = append(devices, device)
+			}
+		}
+	})
+
+	return devices, nil
+}
+
+func (r *memoryRepository) GetMaxCursor(groupID string) (int64, error) {
+	var cursor int64
+	r.read(func(s *memoryState) {
+		for _, device := range s.devices {
+			if device.GroupId == groupID && device.LastOperationId > cursor {
+				cursor = device.LastOperationId
+			}
+		}
+	})
+
+	return cursor, nil
+}
+
+func (r *memoryRepository) GetMaxHLC(groupID string) (int64, error) {
+	var hlc int64
+	r.read(func(s *memoryState) {
+		for _, op := range s.operations {
+			if op.GroupId == groupID && op.HLC > hlc {
+				hlc = op.HLC
+			}
+		}
+	})
+
+	return hlc, nil
+}
+
+func (r *memoryRepository) RemoveOperations(ids []int) error {
+	removed := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		removed[id] = struct{}{}
+	}
+
+	return r.write(func(s *memoryState) error {
+		s.remove(func(op *memoryOperation) bool {
+			_, ok := removed[op.ID]
+
+			return ok
+		})
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) MarkGroupAbandoned(groupID string, at int64) error {
+	return r.write(func(s *memoryState) error {
+		if _, ok := s.abandoned[groupID]; !ok {
+			s.abandoned[groupID] = at
+		}
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) UnmarkGroupAbandoned(groupID string) error {
+	return r.write(func(s *memoryState) error {
+		delete(s.abandoned, groupID)
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) GetAbandonedGroups(before int64) ([]string, error) {
+	groups := make([]string, 0)
+	r.read(func(s *memoryState) {
+		for groupID, at := range s.abandoned {
+			if at < before {
+				groups = append(groups, groupID)
+			}
+		}
+	})
+
+	return groups, nil
+}
+
+func (r *memoryRepository) CreateInvite(invite *common.Invite) error {
+	return r.write(func(s *memoryState) error {
+		if _, ok := s.invites[invite.Code]; ok {
+			return errors.Errorf("invite %s already exists", invite.Code)
+		}
+		s.invites[invite.Code] = *invite
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) GetInvite(code string) (*common.Invite, error) {
+	var invite *common.Invite
+	r.read(func(s *memoryState) {
+		if found, ok := s.invites[code]; ok {
+			invite = &found
+		}
+	})
+
+	return invite, nil
+}
+
+func (r *memoryRepository) GetInvites(groupID string) ([]common.Invite, error) {
+	invites := make([]common.Invite, 0)
+	r.read(func(s *memoryState) {
+		for _, invite := range s.invites {
+			if invite.GroupId == groupID {
+				invites = append(invites, invite)
+			}
+		}
+	})
+	sort.Slice(invites, func(i, j int) bool { return invites[i].CreatedAt < invites[j].CreatedAt })
+
+	return invites, nil
+}
+
+func (r *memoryRepository) RemoveInvite(code string) error {
+	return r.write(func(s *memoryState) error {
+		delete(s.invites, code)
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) RemoveExpiredInvites(before int64) error {
+	return r.write(func(s *memoryState) error {
+		for code, invite := range s.invites {
+			if invite.ExpiresAt < before {
+				delete(s.invites, code)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) GetMember(groupID, userID string) (*common.Member, error) {
+	var member *common.Member
+	r.read(func(s *memoryState) {
+		if found, ok := s.members[memberKey{groupID: groupID, userID: userID}]; ok {
+			member = &found
+		}
+	})
+
+	return member, nil
+}
+
+func (r *memoryRepository) GetMembers(groupID string) ([]common.Member, error) {
+	members := make([]common.Member, 0)
+	r.read(func(s *memoryState) {
+		for key, member := range s.members {
+			if key.groupID == groupID {
+				members = append(members, member)
+			}
+		}
+	})
+	sort.Slice(members, func(i, j int) bool { return members[i].JoinedAt < members[j].JoinedAt })
+
+	return members, nil
+}
+
+func (r *memoryRepository) SaveMember(member *common.Member) error {
+	return r.write(func(s *memoryState) error {
+		key := memberKey{groupID: member.GroupId, userID: member.UserId}
+		saved := *member
+		// like the sql upsert, only the role of an existing member changes
+		if existing, ok := s.members[key]; ok {
+			saved.JoinedAt = existing.JoinedAt
+		}
+		s.members[key] = saved
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) RemoveMember(groupID, userID string) error {
+	return r.write(func(s *memoryState) error {
+		delete(s.members, memberKey{groupID: groupID, userID: userID})
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) GetFieldWrite(groupID, entityName, entityID, field string) (*common.FieldWrite, error) {
+	var write *common.FieldWrite
+	r.read(func(s *memoryState) {
+		key := fieldKey{groupID: groupID, entityName: entityName, entityID: entityID, field: field}
+		if found, ok := s.writes[key]; ok {
+			write = &found
+		}
+	})
+
+	return write, nil
+}
+
+func (r *memoryRepository) SaveFieldWrite(write *common.FieldWrite) error {
+	return r.write(func(s *memoryState) error {
+		key := fieldKey{groupID: write.GroupId, entityName: write.EntityName, entityID: write.EntityId, field: write.Field}
+		s.writes[key] = *write
+
+		return nil
+	})
+}
+
+func (r *memoryRepository) RemoveFieldWrites(groupID, entityName, entityID string) error {
+	return r.write(func(s *memoryState) error {
+		for key := range s.writes {
+			if key.groupID == groupID && key.entityName == entityName && key.entityID == entityID {
+				delete(s.writes, key)
+			}
+		}
+
+		return nil
+	})
+}
+
+// newerWrite orders writes of a field the same way as the merge of the sql repository.
+func newerWrite(a, b common.FieldWrite) bool {
+	return a.Timestamp > b.Timestamp || (a.Timestamp == b.Timestamp && a.Value > b.Value)
+}
+
+func (r *memoryRepository) read(fn func(s *memoryState)) {
+	if !r.inTx {
+		r.mx.RLock()
+		defer r.mx.RUnlock()
+	}
+
+	fn(r.state)
+}
+
+// write changes the state in place, only explicit transactions work on a copy. Like a single sql statement fn must
+// not fail after it changed the state.
+func (r *memoryRepository) write(fn func(s *memoryState) error) error {
+	if !r.inTx {
+		r.mx.Lock()
+		defer r.mx.Unlock()
+	}
+
+	return fn(r.state)
+}
+
+func (s *memoryState) clone() *memoryState {
+	devices := make(map[string]common.DeviceToken, len(s.devices))
+	for token, device := range s.devices {
+		devices[token] = device
+	}
+
+	// snapshots are replaced as a whole, never modified
+	snapshots := make(map[string]*common.Snapshot, len(s.snapshots))
+	for groupID, snapshot := range s.snapshots {
+		snapshots[groupID] = snapshot
+	}
+
+	abandoned := make(map[string]int64, len(s.abandoned))
+	for groupID, at := range s.abandoned {
+		abandoned[groupID] = at
+	}
+
+	invites := make(map[string]common.Invite, len(s.invites))
+	for code, invite := range s.invites {
+		invites[code] = invite
+	}
+
+	members := make(map[memberKey]common.Member, len(s.members))
+	for key, member := range s.members {
+		members[key] = member
+	}
+
+	writes := make(map[fieldKey]common.FieldWrite, len(s.writes))
+	for key, write := range s.writes {
+		writes[key] = write
+	}
+
+	return &memoryState{
+		lastID:     s.lastID,
+		operations: append(make([]*memoryOperation, 0, len(s.operations)), s.operations...),
+		devices:    devices,
+		snapshots:  snapshots,
+		abandoned:  abandoned,
+		invites:    invites,
+		members:    members,
+		writes:     writes,
+	}
+}
+
+func (s *memoryState) insert(operation common.Operation, entities []common.RelatedEntity) *memoryOperation {
+	s.lastID++
+	operation.ID = s.lastID
+
+	inserted := &memoryOperation{
+		Operation: operation,
+		entities:  make([]common.RelatedEntity, 0, len(entities)),
+	}
+	for _, entity := range entities {
+		entity.OperationID = operation.ID
+		inserted.entities = append(inserted.entities, entity)
+	}
+	s.operations = append(s.operations, inserted)
+
+	return inserted
+}
+
+func (s *memoryState) remove(match func(op *memoryOperation) bool) {
+	kept := make([]*memoryOperation, 0, len(s.operations))
+	for _, op := range s.operations {
+		if !match(op) {
+			kept = append(kept, op)
+		}
+	}
+	s.operations = kept
+}
+
+func (s *memoryState) log(match func(op *memoryOperation) bool) []common.LoggedOperation {
+	operations := make([]common.LoggedOperation, 0)
+	for _, op := range s.operations {
+		if match(op) {
+			operations = append(operations, common.LoggedOperation{
+				ID:            op.ID,
+				OperationType: op.OperationType,
+				Sql:           op.Sql,
+				Args:          op.Args,
+				HLC:           op.HLC,
+				Entities:      append([]common.RelatedEntity(nil), op.entities...),
+			})
+		}
+	}
+
+	return operations
+}
+
+func (s *memoryState) findByClientID(groupID, clientID string) *memoryOperation {
+	for _, op := range s.operations {
+		if op.GroupId == groupID && op.ClientOperationId != nil && *op.ClientOperationId == clientID {
+			return op
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS device_tokens
+(
+    device_token text PRIMARY KEY,
+    user_id      text   NOT NULL,
+    group_id     text   NOT NULL,
+    last_sync    bigint NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS device_tokens_group_id_idx ON device_tokens (group_id);
+CREATE INDEX IF NOT EXISTS device_tokens_user_id_idx ON device_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS operations
+(
+    id             bigserial PRIMARY KEY,
+    device_token   text   NOT NULL,
+    group_id       text   NOT NULL,
+    operation_type text   NOT NULL,
+    sql            text   NOT NULL,
+    args           text   NOT NULL,
+    created_at     bigint NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS operations_group_id_id_idx ON operations (group_id, id);
+
+CREATE TABLE IF NOT EXISTS related_entities
+(
+    operation_id bigint NOT NULL REFERENCES operations (id) ON DELETE CASCADE,
+    entity_id    text   NOT NULL,
+    entity_name  text   NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS related_entities_operation_id_idx ON related_entities (operation_id);
+CREATE INDEX IF NOT EXISTS related_entities_entity_idx ON related_entities (entity_name, entity_id);
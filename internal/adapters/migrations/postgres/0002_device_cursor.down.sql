@@ -0,0 +1,2 @@
+ALTER TABLE device_tokens
+    DROP COLUMN IF EXISTS last_operation_id;
@@ -0,0 +1,9 @@
+ALTER TABLE device_tokens
+    ADD COLUMN IF NOT EXISTS last_operation_id bigint NOT NULL DEFAULT 0;
+
+-- devices have seen every operation of their group created before their last sync
+UPDATE device_tokens d
+SET last_operation_id = coalesce((SELECT max(o.id)
+                                  FROM operations o
+                                  WHERE o.group_id = d.group_id
+                                    AND o.created_at <= d.last_sync), 0);
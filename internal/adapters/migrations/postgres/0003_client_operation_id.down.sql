@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS operations_group_id_client_operation_id_key;
+
+ALTER TABLE operations
+    DROP COLUMN IF EXISTS client_operation_id;
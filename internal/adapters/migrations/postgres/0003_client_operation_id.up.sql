@@ -0,0 +1,5 @@
+ALTER TABLE operations
+    ADD COLUMN IF NOT EXISTS client_operation_id text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS operations_group_id_client_operation_id_key
+    ON operations (group_id, client_operation_id);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS snapshots
+(
+    group_id   text PRIMARY KEY,
+    watermark  bigint NOT NULL,
+    created_at bigint NOT NULL,
+    operations text   NOT NULL
+);
@@ -0,0 +1,2 @@
+ALTER TABLE snapshots
+    DROP COLUMN IF EXISTS pruned_up_to;
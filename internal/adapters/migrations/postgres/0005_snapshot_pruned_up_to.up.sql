@@ -0,0 +1,2 @@
+ALTER TABLE snapshots
+    ADD COLUMN IF NOT EXISTS pruned_up_to bigint NOT NULL DEFAULT 0;
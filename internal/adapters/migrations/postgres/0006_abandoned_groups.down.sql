@@ -0,0 +1 @@
+DROP TABLE IF EXISTS abandoned_groups;
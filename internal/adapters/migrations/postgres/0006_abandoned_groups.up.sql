@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS abandoned_groups
+(
+    group_id     text PRIMARY KEY,
+    abandoned_at bigint NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS abandoned_groups_abandoned_at_idx ON abandoned_groups (abandoned_at);
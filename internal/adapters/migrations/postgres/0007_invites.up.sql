@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS invites
+(
+    code       text PRIMARY KEY,
+    group_id   text    NOT NULL,
+    created_by text    NOT NULL,
+    created_at bigint  NOT NULL,
+    expires_at bigint  NOT NULL,
+    single_use boolean NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS invites_group_id_idx ON invites (group_id);
+CREATE INDEX IF NOT EXISTS invites_expires_at_idx ON invites (expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE invites
+    DROP COLUMN IF EXISTS role;
+
+DROP TABLE IF EXISTS group_members;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS group_members
+(
+    group_id  text   NOT NULL,
+    user_id   text   NOT NULL,
+    role      text   NOT NULL,
+    joined_at bigint NOT NULL,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS group_members_user_id_idx ON group_members (user_id);
+
+-- members of shared groups joined before roles existed keep editing rights
+INSERT INTO group_members (group_id, user_id, role, joined_at)
+SELECT DISTINCT group_id, user_id, 'editor', 0
+FROM device_tokens
+WHERE group_id != user_id
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE invites
+    ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'editor';
@@ -0,0 +1,11 @@
+-- values compare byte-wise like on clients, so every replica breaks timestamp ties the same way
+CREATE TABLE IF NOT EXISTS field_writes
+(
+    group_id    text   NOT NULL,
+    entity_name text   NOT NULL,
+    entity_id   text   NOT NULL,
+    field       text   NOT NULL,
+    timestamp   bigint NOT NULL,
+    value       text COLLATE "C" NOT NULL,
+    PRIMARY KEY (group_id, entity_name, entity_id, field)
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS operations_group_id_hlc_idx;
+
+ALTER TABLE operations
+    DROP COLUMN IF EXISTS hlc;
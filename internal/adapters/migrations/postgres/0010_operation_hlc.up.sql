@@ -0,0 +1,5 @@
+-- operations logged before the clock keep zero, so they stay ordered by id ahead of stamped ones
+ALTER TABLE operations
+    ADD COLUMN IF NOT EXISTS hlc bigint NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS operations_group_id_hlc_idx ON operations (group_id, hlc);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS related_entities;
+DROP TABLE IF EXISTS operations;
+DROP TABLE IF EXISTS device_tokens;
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS device_tokens
+(
+    device_token      TEXT PRIMARY KEY,
+    user_id           TEXT    NOT NULL,
+    group_id          TEXT    NOT NULL,
+    last_sync         INTEGER NOT NULL DEFAULT 0,
+    last_operation_id INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS device_tokens_group_id_idx ON device_tokens (group_id);
+CREATE INDEX IF NOT EXISTS device_tokens_user_id_idx ON device_tokens (user_id);
+
+-- AUTOINCREMENT never reuses ids, device cursors rely on that
+CREATE TABLE IF NOT EXISTS operations
+(
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    client_operation_id TEXT,
+    device_token        TEXT    NOT NULL,
+    group_id            TEXT    NOT NULL,
+    operation_type      TEXT    NOT NULL,
+    sql                 TEXT    NOT NULL,
+    args                TEXT    NOT NULL,
+    created_at          INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS operations_group_id_id_idx ON operations (group_id, id);
+CREATE UNIQUE INDEX IF NOT EXISTS operations_group_id_client_operation_id_key
+    ON operations (group_id, client_operation_id);
+
+CREATE TABLE IF NOT EXISTS related_entities
+(
+    operation_id INTEGER NOT NULL REFERENCES operations (id) ON DELETE CASCADE,
+    entity_id    TEXT    NOT NULL,
+    entity_name  TEXT    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS related_entities_operation_id_idx ON related_entities (operation_id);
+CREATE INDEX IF NOT EXISTS related_entities_entity_idx ON related_entities (entity_name, entity_id);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS snapshots
+(
+    group_id   TEXT PRIMARY KEY,
+    watermark  INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    operations TEXT    NOT NULL
+);
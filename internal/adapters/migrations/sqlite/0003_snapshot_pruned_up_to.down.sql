@@ -0,0 +1,2 @@
+ALTER TABLE snapshots
+    DROP COLUMN pruned_up_to;
@@ -0,0 +1,2 @@
+ALTER TABLE snapshots
+    ADD COLUMN pruned_up_to INTEGER NOT NULL DEFAULT 0;
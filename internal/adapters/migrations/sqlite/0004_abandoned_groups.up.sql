@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS abandoned_groups
+(
+    group_id     TEXT PRIMARY KEY,
+    abandoned_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS abandoned_groups_abandoned_at_idx ON abandoned_groups (abandoned_at);
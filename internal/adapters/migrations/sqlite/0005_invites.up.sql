@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS invites
+(
+    code       TEXT PRIMARY KEY,
+    group_id   TEXT    NOT NULL,
+    created_by TEXT    NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    single_use INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS invites_group_id_idx ON invites (group_id);
+CREATE INDEX IF NOT EXISTS invites_expires_at_idx ON invites (expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE invites
+    DROP COLUMN role;
+
+DROP TABLE IF EXISTS group_members;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS group_members
+(
+    group_id  TEXT    NOT NULL,
+    user_id   TEXT    NOT NULL,
+    role      TEXT    NOT NULL,
+    joined_at INTEGER NOT NULL,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS group_members_user_id_idx ON group_members (user_id);
+
+-- members of shared groups joined before roles existed keep editing rights
+INSERT OR IGNORE INTO group_members (group_id, user_id, role, joined_at)
+SELECT DISTINCT group_id, user_id, 'editor', 0
+FROM device_tokens
+WHERE group_id != user_id;
+
+ALTER TABLE invites
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'editor';
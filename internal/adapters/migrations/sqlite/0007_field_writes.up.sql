@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS field_writes
+(
+    group_id    TEXT    NOT NULL,
+    entity_name TEXT    NOT NULL,
+    entity_id   TEXT    NOT NULL,
+    field       TEXT    NOT NULL,
+    timestamp   INTEGER NOT NULL,
+    value       TEXT    NOT NULL,
+    PRIMARY KEY (group_id, entity_name, entity_id, field)
+);
@@ -0,0 +1,203 @@
+package adapters
+
+import (
+	"embed"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// migrationsLockID serializes migrations of replicas starting at the same time
+const migrationsLockID = 7_341_852_011
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+type migrator struct {
+	client     *gorm.DB
+	migrations []migration
+}
+
+func NewMigrator(db *gorm.DB) (Migrator, error) {
+	if db == nil {
+		// the memory driver has no schema
+		return nil, nil
+	}
+
+	list, err := loadMigrations(db.Dialector.Name())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load migrations")
+	}
+
+	return &migrator{
+		client:     db,
+		migrations: list,
+	}, nil
+}
+
+func (m migrator) Up() error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+
+	for _, mg := range m.migrations {
+		err := m.client.Transaction(func(tx *gorm.DB) error {
+			applied, err := m.lock(tx, mg.version)
+			if err != nil || applied {
+				return err
+			}
+
+			if err = tx.Exec(mg.up).Error; err != nil {
+				return errors.Wrapf(err, "failed to apply migration %s", mg.name)
+			}
+
+			return tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+				mg.version, time.Now().UnixMicro()).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m migrator) Down(steps int) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		mg := m.migrations[i]
+		err := m.client.Transaction(func(tx *gorm.DB) error {
+			applied, err := m.lock(tx, mg.version)
+			if err != nil || !applied {
+				return err
+			}
+
+			if err = tx.Exec(mg.down).Error; err != nil {
+				return errors.Wrapf(err, "failed to revert migration %s", mg.name)
+			}
+
+			steps--
+
+			return tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, mg.version).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m migrator) Pending() (int, error) {
+	if err := m.prepare(); err != nil {
+		return 0, err
+	}
+
+	var applied int64
+	err := m.client.Raw(`SELECT count(*) FROM schema_migrations`).Scan(&applied).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to count applied migrations")
+	}
+
+	return len(m.migrations) - int(applied), nil
+}
+
+func (m migrator) prepare() error {
+	err := m.client.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations
+		(
+			version    bigint PRIMARY KEY,
+			applied_at bigint NOT NULL
+		)`).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to create migrations table")
+	}
+
+	return nil
+}
+
+// lock takes the migrations lock for the transaction and reports whether the version is applied.
+func (m migrator) lock(tx *gorm.DB, version int) (bool, error) {
+	if tx.Dialector.Name() == "postgres" {
+		if err := tx.Exec(`SELECT pg_advisory_xact_lock(?)`, migrationsLockID).Error; err != nil {
+			return false, errors.Wrap(err, "failed to lock migrations")
+		}
+	}
+
+	var count int64
+	err := tx.Raw(`SELECT count(*) FROM schema_migrations WHERE version = ?`, version).Scan(&count).Error
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check migration version")
+	}
+
+	return count > 0, nil
+}
+
+// loadMigrations reads migrations/<dialect>/<version>_<name>.(up|down).sql ordered by version.
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	files, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "no migrations for %s", dialect)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, file := range files {
+		name, direction, ok := strings.Cut(strings.TrimSuffix(file.Name(), ".sql"), ".")
+		if !ok {
+			return nil, errors.Errorf("migration %s has no direction", file.Name())
+		}
+
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "migration %s has no version", file.Name())
+		}
+
+		content, err := migrations.ReadFile(path.Join(dir, file.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read migration %s", file.Name())
+		}
+
+		mg, ok := byVersion[version]
+		if !ok {
+			mg = &migration{version: version, name: name}
+			byVersion[version] = mg
+		}
+
+		switch direction {
+		case "up":
+			mg.up = string(content)
+		case "down":
+			mg.down = string(content)
+		default:
+			return nil, errors.Errorf("migration %s has unknown direction %s", file.Name(), direction)
+		}
+	}
+
+	list := make([]migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		if mg.up == "" || mg.down == "" {
+			return nil, errors.Errorf("migration %s needs both up and down files", mg.name)
+		}
+
+		list = append(list, *mg)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].version < list[j].version })
+
+	return list, nil
+}
@@ -0,0 +1,116 @@
+package adapters
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// operationsChannel carries a notification for every transaction that commits operations
+const operationsChannel = "sync_operations"
+
+// ReplicaID tells notifications of this process from the ones of other replicas
+type ReplicaID string
+
+func NewReplicaID() (ReplicaID, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate replica id")
+	}
+
+	return ReplicaID(hex.EncodeToString(b)), nil
+}
+
+type notification struct {
+	GroupID     string    `json:"group_id"`
+	DeviceToken string    `json:"device_token,omitempty"`
+	ReplicaID   ReplicaID `json:"replica_id"`
+}
+
+type listener struct {
+	db        *sql.DB
+	replicaID ReplicaID
+	logger    *logrus.Entry
+}
+
+// NewListener returns nil for drivers without NOTIFY, a single replica learns about its commits itself.
+func NewListener(cfg *common.Config, db *gorm.DB, replicaID ReplicaID, logger *logrus.Entry) (Listener, error) {
+	if cfg.DatabaseDriver != common.DatabasePostgres {
+		return nil, nil
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get sql db")
+	}
+
+	return &listener{
+		db:        sqlDB,
+		replicaID: replicaID,
+		logger:    logger,
+	}, nil
+}
+
+func (l *listener) Listen(ctx context.Context, fn func(groupID, deviceToken string)) error {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get connection")
+	}
+	// the session keeps listening after LISTEN, so it must not go back to the pool
+	defer discard(conn)
+
+	return conn.Raw(func(driverConn any) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pgConn.Exec(ctx, `LISTEN `+operationsChannel); err != nil {
+			return errors.Wrap(err, "failed to listen")
+		}
+
+		for {
+			n, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return errors.Wrap(err, "failed to wait for notification")
+			}
+
+			// anyone allowed to connect can notify the channel, a foreign payload must not stop the listener
+			var payload notification
+			if err = json.Unmarshal([]byte(n.Payload), &payload); err != nil {
+				l.logger.WithError(err).WithField("payload", n.Payload).Warn("failed to decode notification")
+
+				continue
+			}
+			// the replica that committed has signalled its subscribers already
+			if payload.ReplicaID == l.replicaID {
+				continue
+			}
+
+			fn(payload.GroupID, payload.DeviceToken)
+		}
+	})
+}
+
+// notifyCommit queues a notification about operations of the group, postgres delivers it once the transaction
+// commits and drops it on rollback. The device token is empty for operations not uploaded by a device.
+func (r repository) notifyCommit(tx *gorm.DB, groupID, deviceToken string) error {
+	if !r.notify {
+		return nil
+	}
+
+	payload, err := json.Marshal(notification{GroupID: groupID, DeviceToken: deviceToken, ReplicaID: r.replicaID})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode notification")
+	}
+
+	err = tx.Exec(`SELECT pg_notify(?, ?)`, operationsChannel, string(payload)).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to notify")
+	}
+
+	return nil
+}
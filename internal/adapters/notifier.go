@@ -0,0 +1,79 @@
+package adapters
+
+import (
+	"context"
+	firebase "firebase.google.com/go"
+	"firebase.google.com/go/messaging"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// fcmMaxTokens is the limit of tokens in a single multicast message
+const fcmMaxTokens = 500
+
+// fcmNotifier sends data-only messages, the client syncs in the background instead of showing anything
+type fcmNotifier struct {
+	client *messaging.Client
+	logger *logrus.Entry
+}
+
+type logNotifier struct {
+	logger *logrus.Entry
+}
+
+func NewNotifier(cfg *common.Config, firebaseApp *firebase.App, logger *logrus.Entry) (Notifier, error) {
+	logger = logger.WithField("notifier", cfg.Notifier)
+
+	switch cfg.Notifier {
+	case common.NotifierFCM:
+		client, err := firebaseApp.Messaging(context.Background())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create messaging client")
+		}
+
+		return &fcmNotifier{client: client, logger: logger}, nil
+	case common.NotifierLog:
+		return &logNotifier{logger: logger}, nil
+	default:
+		return nil, errors.Errorf("unknown notifier %q", cfg.Notifier)
+	}
+}
+
+func (n *fcmNotifier) Notify(ctx context.Context, groupID string, deviceTokens []string) error {
+	for i := 0; i < len(deviceTokens); i += fcmMaxTokens {
+		end := i + fcmMaxTokens
+		if end > len(deviceTokens) {
+			end = len(deviceTokens)
+		}
+
+		response, err := n.client.SendMulticast(ctx, &messaging.MulticastMessage{
+			Tokens: deviceTokens[i:end],
+			Data:   map[string]string{"group_id": groupID},
+			// a device that was offline for a while gets one message however many were sent meanwhile
+			Android: &messaging.AndroidConfig{CollapseKey: groupID, Priority: "normal"},
+			APNS: &messaging.APNSConfig{
+				Headers: map[string]string{"apns-push-type": "background", "apns-priority": "5", "apns-collapse-id": groupID},
+				Payload: &messaging.APNSPayload{Aps: &messaging.Aps{ContentAvailable: true}},
+			},
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to send messages")
+		}
+
+		// a device that fails to get the message still syncs on its own, so failures are only logged
+		for j, r := range response.Responses {
+			if !r.Success {
+				n.logger.WithError(r.Error).WithField("device_token", deviceTokens[i+j]).Warn("failed to notify device")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (n *logNotifier) Notify(_ context.Context, groupID string, deviceTokens []string) error {
+	n.logger.WithField("group_id", groupID).WithField("device_tokens", deviceTokens).Info("group changed")
+
+	return nil
+}
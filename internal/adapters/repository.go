@@ -1,21 +1,48 @@
 package adapters
 
 import (
+	"fmt"
 	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
 	"github.com/Gregmus2/sync-service/internal/common"
 	"github.com/pkg/errors"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 	"time"
 )
 
+const removeChunkSize = 1000
+
+// skipDuplicateOperations ignores operations whose client id is already stored in the group
+var skipDuplicateOperations = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "group_id"}, {Name: "client_operation_id"}},
+	DoNothing: true,
+}
+
 type repository struct {
 	client *gorm.DB
+	// notify is set for postgres, where other replicas listen for committed operations
+	notify    bool
+	replicaID ReplicaID
 }
 
 func NewDB(cfg *common.Config) (*gorm.DB, error) {
-	db, err := gorm.Open(postgres.Open(cfg.DatabaseFQDN), &gorm.Config{
+	var dialector gorm.Dialector
+	switch cfg.DatabaseDriver {
+	case common.DatabasePostgres:
+		dialector = postgres.Open(cfg.DatabaseFQDN)
+	case common.DatabaseSQLite:
+		dialector = sqlite.Open(fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL", cfg.DatabasePath))
+	case common.DatabaseMemory:
+		// the memory repository doesn't use a database
+		return nil, nil
+	default:
+		return nil, errors.Errorf("unknown database driver %q", cfg.DatabaseDriver)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
 		FullSaveAssociations: true,
 		Logger:               logger.Default.LogMode(logger.Info),
 	})
@@ -23,45 +50,105 @@ func NewDB(cfg *common.Config) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	if cfg.DatabaseDriver == common.DatabaseSQLite {
+		// sqlite has a single writer, a shared connection keeps transactions from failing with SQLITE_BUSY
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+
 	return db, nil
 }
 
-func NewRepository(db *gorm.DB) (Repository, error) {
+// NewRepository works with both postgres and sqlite, queries must stay within the syntax both of them support:
+// upserts with ON CONFLICT need sqlite 3.24 and RETURNING needs 3.35, json is encoded in go rather than in sql.
+// Advisory locks and NOTIFY exist only in postgres, so sqlite serves a single replica with the memory group mutex.
+func NewRepository(cfg *common.Config, db *gorm.DB, replicaID ReplicaID) (Repository, error) {
+	if cfg.DatabaseDriver == common.DatabaseMemory {
+		return NewMemoryRepository(), nil
+	}
+
 	return &repository{
-		client: db,
+		client:    db,
+		notify:    cfg.DatabaseDriver == common.DatabasePostgres,
+		replicaID: replicaID,
 	}, nil
 }
 
-func (r repository) UpdateDeviceTokenTime(deviceToken, userID, groupID string) error {
+func (r repository) WithTx(fn func(repo Repository) error) error {
+	return r.client.Transaction(func(tx *gorm.DB) error {
+		return fn(&repository{client: tx, notify: r.notify, replicaID: r.replicaID})
+	})
+}
+
+func (r repository) UpdateDeviceCursor(deviceToken, userID, groupID string) (int64, error) {
+	var cursor int64
+	err := r.client.Raw(
+		`INSERT INTO device_tokens(device_token, user_id, group_id, last_sync, last_operation_id) 
+				VALUES(?, ?, ?, ?, (SELECT coalesce(max(id), 0) FROM operations WHERE group_id = ?)) 
+				ON CONFLICT(device_token) DO UPDATE SET last_sync=excluded.last_sync, last_operation_id=excluded.last_operation_id,
+				                                        user_id=excluded.user_id, group_id=excluded.group_id
+				RETURNING last_operation_id;`,
+		deviceToken, userID, groupID, time.Now().UnixMicro(), groupID).Scan(&cursor).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to update device cursor")
+	}
+
+	return cursor, nil
+}
+
+func (r repository) AdvanceDeviceCursor(deviceToken string, cursor int64) error {
 	err := r.client.Exec(
-		`INSERT INTO device_tokens(device_token, user_id, group_id, last_sync) VALUES(?, ?, ?, ?) 
-				ON CONFLICT(device_token) DO UPDATE SET last_sync=excluded.last_sync, user_id=excluded.user_id, group_id=excluded.group_id;`,
-		deviceToken, userID, groupID, time.Now().UnixMicro()).Error
+		`UPDATE device_tokens SET last_operation_id = ? WHERE device_token = ? AND last_operation_id < ?`,
+		cursor, deviceToken, cursor,
+	).Error
 	if err != nil {
-		return errors.Wrap(err, "failed to update device token time")
+		return errors.Wrap(err, "failed to advance device cursor")
 	}
 
 	return nil
 }
 
-func (r repository) InsertData(deviceToken, groupID string, operations []*proto.Operation) error {
-	return r.client.Transaction(func(tx *gorm.DB) error {
-		for _, op := range operations {
+func (r repository) InsertData(deviceToken, groupID string, operations []*proto.Operation, stamps []int64) ([]*proto.OperationAck, error) {
+	acks := make([]*proto.OperationAck, 0, len(operations))
+	err := r.client.Transaction(func(tx *gorm.DB) error {
+		inserted := false
+		for i, op := range operations {
 			operation := &common.Operation{
-				DeviceToken:   deviceToken,
-				GroupId:       groupID,
-				OperationType: op.Type.String(),
-				Sql:           op.Sql,
-				Args:          op.Args,
-				CreatedAt:     time.Now().UnixMicro(),
+				ClientOperationId: clientOperationID(op),
+				DeviceToken:       deviceToken,
+				GroupId:           groupID,
+				OperationType:     op.Type.String(),
+				Sql:               op.Sql,
+				Args:              op.Args,
+				CreatedAt:         time.Now().UnixMicro(),
+				HLC:               stamps[i],
 			}
-			err := tx.Create(operation).Error
-			if err != nil {
-				return errors.Wrap(err, "failed to insert data")
+			// retried uploads carry the same operation ids, they are already stored and must not be replayed twice
+			result := tx.Clauses(skipDuplicateOperations).Create(operation)
+			if result.Error != nil {
+				return errors.Wrap(result.Error, "failed to insert data")
+			}
+			if result.RowsAffected == 0 {
+				// acknowledge the duplicate with the sequence it got on the first upload
+				err := tx.Raw(`SELECT id FROM operations WHERE group_id = ? AND client_operation_id = ?`, groupID, op.Id).
+					Scan(&operation.ID).Error
+				if err != nil {
+					return errors.Wrap(err, "failed to select duplicated operation")
+				}
+				acks = append(acks, &proto.OperationAck{Id: op.Id, Sequence: int64(operation.ID)})
+
+				continue
+			}
+			inserted = true
+			if op.Id != "" {
+				acks = append(acks, &proto.OperationAck{Id: op.Id, Sequence: int64(operation.ID)})
 			}
 
 			for _, entity := range op.RelatedEntities {
-				err = tx.Exec(`INSERT INTO related_entities (operation_id, entity_id, entity_name) 
+				err := tx.Exec(`INSERT INTO related_entities (operation_id, entity_id, entity_name) 
 				VALUES (?, ?, ?);`, operation.ID, entity.Id, entity.Name).Error
 				if err != nil {
 					return errors.Wrap(err, "failed to insert related entities")
@@ -69,17 +156,37 @@ func (r repository) InsertData(deviceToken, groupID string, operations []*proto.
 			}
 		}
 
-		return nil
+		if !inserted {
+			return nil
+		}
+
+		return r.notifyCommit(tx, groupID, deviceToken)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return acks, nil
+}
+
+func (r repository) GetOperationID(groupID, clientOperationID string) (int64, error) {
+	var id int64
+	err := r.client.Raw(`SELECT id FROM operations WHERE group_id = ? AND client_operation_id = ?`, groupID, clientOperationID).
+		Scan(&id).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to select operation")
+	}
+
+	return id, nil
 }
 
 func (r repository) CleanConflicted(deviceToken, groupID string) error {
 	err := r.client.Exec(
 		`DELETE FROM operations
 				WHERE group_id = ?
-				  AND created_at > coalesce((SELECT last_sync
-											 FROM device_tokens
-											 WHERE device_token = ?), 0)
+				  AND id > coalesce((SELECT last_operation_id
+									 FROM device_tokens
+									 WHERE device_token = ?), 0)
 				  AND EXISTS (SELECT null
 							  FROM operations AS op2
 									   JOIN related_entities re2 on op2.id = re2.operation_id
@@ -114,39 +221,54 @@ func (r repository) GetGroupID(deviceToken, userID string) (string, error) {
 	return groupID, nil
 }
 
-type data struct {
-	Sql  string
-	Args string
+func clientOperationID(op *proto.Operation) *string {
+	if op.Id == "" {
+		return nil
+	}
+
+	return &op.Id
 }
 
-func (r repository) GetData(deviceToken, groupID string) ([]*proto.SimpleOperation, error) {
-	return r.queryData(r.client.Raw(
-		`SELECT sql, args
-				FROM operations
-				WHERE group_id = ? and 
-				      device_token != ? and 
-				      created_at > coalesce((SELECT last_sync FROM device_tokens WHERE device_token = ?), 0)
-				ORDER BY id`,
+func (r repository) GetData(deviceToken, groupID string) ([]common.LoggedOperation, error) {
+	return r.queryLog(
+		`hlc, id`,
+		`group_id = ? and 
+				device_token != ? and 
+				id > coalesce((SELECT last_operation_id FROM device_tokens WHERE device_token = ?), 0)`,
 		groupID, deviceToken, deviceToken,
-	))
+	)
 }
 
-func (r repository) queryData(tx *gorm.DB) ([]*proto.SimpleOperation, error) {
-	operations := make([]*data, 0)
-	err := tx.Scan(&operations).Error
+// queryLog selects operations matching the condition in the given order together with their related entities.
+func (r repository) queryLog(order, condition string, args ...any) ([]common.LoggedOperation, error) {
+	operations := make([]common.LoggedOperation, 0)
+	err := r.client.Raw(
+		`SELECT id, operation_type, sql, args, hlc FROM operations WHERE `+condition+` ORDER BY `+order, args...,
+	).Scan(&operations).Error
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to prepare select data")
+		return nil, errors.Wrap(err, "failed to select operations")
 	}
 
-	rows := make([]*proto.SimpleOperation, 0)
-	for _, op := range operations {
-		rows = append(rows, &proto.SimpleOperation{
-			Sql:  op.Sql,
-			Args: op.Args,
-		})
+	entities := make([]common.RelatedEntity, 0)
+	err = r.client.Raw(
+		`SELECT related_entities.operation_id, related_entities.entity_id, related_entities.entity_name
+				FROM related_entities
+				JOIN operations ON operations.id = related_entities.operation_id
+				WHERE `+condition, args...,
+	).Scan(&entities).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select related entities")
 	}
 
-	return rows, nil
+	byOperation := make(map[int][]common.RelatedEntity)
+	for _, entity := range entities {
+		byOperation[entity.OperationID] = append(byOperation[entity.OperationID], entity)
+	}
+	for i := range operations {
+		operations[i].Entities = byOperation[operations[i].ID]
+	}
+
+	return operations, nil
 }
 
 func (r repository) UpdateGroupID(userID, newGroupID string) error {
@@ -160,46 +282,101 @@ func (r repository) UpdateGroupID(userID, newGroupID string) error {
 	return nil
 }
 
+// MigrateData moves operations by copying them, so they get ids past the cursors of the target group devices.
+// CopyOperations notifies about the target group.
 func (r repository) MigrateData(fromID, toID string) error {
-	err := r.client.Exec(
-		`UPDATE operations SET group_id = ?, created_at = ? WHERE group_id = ?`, toID, time.Now().UnixMicro(), fromID,
-	).Error
-	if err != nil {
-		return errors.Wrap(err, "failed to migrate data")
-	}
+	return r.WithTx(func(repo Repository) error {
+		if _, err := repo.CopyOperations(fromID, toID); err != nil {
+			return errors.Wrap(err, "failed to migrate data")
+		}
 
-	return nil
+		return repo.RemoveData(fromID)
+	})
 }
 
-func (r repository) RemoveData(userID string) error {
-	err := r.client.Exec(
-		`DELETE FROM operations WHERE group_id = ?`, userID,
-	).Error
-	if err != nil {
-		return errors.Wrap(err, "failed to remove data")
-	}
+func (r repository) RemoveData(groupID string) error {
+	return r.client.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`DELETE FROM operations WHERE group_id = ?`, groupID).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to remove data")
+		}
 
-	return nil
+		err = tx.Exec(`DELETE FROM snapshots WHERE group_id = ?`, groupID).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to remove snapshot")
+		}
+
+		err = tx.Exec(`DELETE FROM abandoned_groups WHERE group_id = ?`, groupID).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to remove abandoned mark")
+		}
+
+		err = tx.Exec(`DELETE FROM invites WHERE group_id = ?`, groupID).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to remove invites")
+		}
+
+		err = tx.Exec(`DELETE FROM group_members WHERE group_id = ?`, groupID).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to remove members")
+		}
+
+		err = tx.Exec(`DELETE FROM field_writes WHERE group_id = ?`, groupID).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to remove field writes")
+		}
+
+		return nil
+	})
 }
 
-func (r repository) GetAllData(groupID string) ([]*proto.SimpleOperation, error) {
-	return r.queryData(r.client.Raw(
-		`SELECT sql, args
-				FROM operations 
-				WHERE group_id = ?
-				ORDER BY id`,
-		groupID,
-	))
+func (r repository) GetAllData(groupID string) ([]common.LoggedOperation, error) {
+	return r.queryLog(`id`, `group_id = ?`, groupID)
 }
 
-func (r repository) CopyOperations(fromID, toID string) error {
-	return r.client.Transaction(func(tx *gorm.DB) error {
+func (r repository) CopyOperations(fromID, toID string) ([]common.CopiedOperation, error) {
+	copied := make([]common.CopiedOperation, 0)
+	err := r.client.Transaction(func(tx *gorm.DB) error {
+		// pruned operations exist only in the snapshot, it replaces the log up to its watermark
+		snapshot, err := repository{client: tx}.GetSnapshot(fromID)
+		if err != nil {
+			return err
+		}
+
+		var after int64
+		if snapshot != nil && snapshot.PrunedUpTo > 0 {
+			after = snapshot.Watermark
+			for _, op := range snapshot.Operations {
+				operation := &common.Operation{
+					GroupId:       toID,
+					OperationType: op.OperationType,
+					Sql:           op.Sql,
+					Args:          op.Args,
+					CreatedAt:     snapshot.CreatedAt,
+					HLC:           op.HLC,
+				}
+				if err = tx.Create(operation).Error; err != nil {
+					return errors.Wrap(err, "failed to insert snapshot data")
+				}
+				copied = append(copied, common.CopiedOperation{FromID: int64(op.ID), ToID: int64(operation.ID)})
+
+				for _, entity := range op.Entities {
+					err = tx.Exec(`INSERT INTO related_entities (operation_id, entity_id, entity_name) 
+						VALUES (?, ?, ?);`, operation.ID, entity.EntityID, entity.EntityName).Error
+					if err != nil {
+						return errors.Wrap(err, "failed to insert related entities")
+					}
+				}
+			}
+		}
+
 		operations := make([]common.Operation, 0)
-		err := r.client.Raw(
-			`SELECT id, device_token, operation_type, sql, args, created_at
+		err = tx.Raw(
+			`SELECT id, client_operation_id, device_token, operation_type, sql, args, created_at, hlc
 				FROM operations
-				WHERE group_id = ?`,
-			fromID,
+				WHERE group_id = ? AND id > ?
+				ORDER BY id`,
+			fromID, after,
 		).Scan(&operations).Error
 		if err != nil {
 			return errors.Wrap(err, "failed to prepare select data")
@@ -207,19 +384,25 @@ func (r repository) CopyOperations(fromID, toID string) error {
 
 		for _, op := range operations {
 			operation := &common.Operation{
-				DeviceToken:   op.DeviceToken,
-				GroupId:       toID,
-				OperationType: op.OperationType,
-				Sql:           op.Sql,
-				Args:          op.Args,
-				CreatedAt:     op.CreatedAt,
+				ClientOperationId: op.ClientOperationId,
+				DeviceToken:       op.DeviceToken,
+				GroupId:           toID,
+				OperationType:     op.OperationType,
+				Sql:               op.Sql,
+				Args:              op.Args,
+				CreatedAt:         op.CreatedAt,
+				HLC:               op.HLC,
 			}
-			err = tx.Create(operation).Error
-			if err != nil {
-				return errors.Wrap(err, "failed to insert data")
+			result := tx.Clauses(skipDuplicateOperations).Create(operation)
+			if result.Error != nil {
+				return errors.Wrap(result.Error, "failed to insert data")
 			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			copied = append(copied, common.CopiedOperation{FromID: int64(op.ID), ToID: int64(operation.ID)})
 
-			err = r.client.Exec(
+			err = tx.Exec(
 				`INSERT INTO related_entities (operation_id, entity_id, entity_name) 
 				SELECT ?, entity_id, entity_name FROM related_entities
 					WHERE operation_id = ?;`, operation.ID, op.ID,
@@ -229,13 +412,23 @@ func (r repository) CopyOperations(fromID, toID string) error {
 			}
 		}
 
-		return nil
+		if err = mergeFieldWrites(tx, fromID, toID); err != nil {
+			return err
+		}
+
+		return r.notifyCommit(tx, toID, "")
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return copied, nil
 }
 
 func (r repository) IsGroupExists(groupID string) (bool, error) {
 	var count int64
-	err := r.client.Raw(`SELECT count(*) FROM device_tokens WHERE group_id = ?`, groupID).
+	err := r.client.Raw(`SELECT (SELECT count(*) FROM device_tokens WHERE group_id = ?) + 
+				(SELECT count(*) FROM abandoned_groups WHERE group_id = ?)`, groupID, groupID).
 		Scan(&count).Error
 	if err != nil {
 		return false, errors.Wrap(err, "failed to prepare select group id")
@@ -243,3 +436,89 @@ func (r repository) IsGroupExists(groupID string) (bool, error) {
 
 	return count > 0, nil
 }
+
+func (r repository) GetGroupDevices(groupID string) ([]common.DeviceToken, error) {
+	devices := make([]common.DeviceToken, 0)
+	err := r.client.Raw(
+		`SELECT device_token, user_id, group_id, last_sync, last_operation_id
+				FROM device_tokens
+				WHERE group_id = ?`,
+		groupID,
+	).Scan(&devices).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select group devices")
+	}
+
+	return devices, nil
+}
+
+func (r repository) GetMaxCursor(groupID string) (int64, error) {
+	var cursor int64
+	err := r.client.Raw(
+		`SELECT coalesce(max(last_operation_id), 0) FROM device_tokens WHERE group_id = ?`, groupID,
+	).Scan(&cursor).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to select max cursor")
+	}
+
+	return cursor, nil
+}
+
+func (r repository) GetMaxHLC(groupID string) (int64, error) {
+	var hlc int64
+	err := r.client.Raw(`SELECT coalesce(max(hlc), 0) FROM operations WHERE group_id = ?`, groupID).Scan(&hlc).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to select max hlc")
+	}
+
+	return hlc, nil
+}
+
+func (r repository) RemoveOperations(ids []int) error {
+	return r.client.Transaction(func(tx *gorm.DB) error {
+		// chunks keep the statement under the bound parameters limit of sqlite
+		for i := 0; i < len(ids); i += removeChunkSize {
+			end := i + removeChunkSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+
+			if err := tx.Exec(`DELETE FROM operations WHERE id IN ?`, ids[i:end]).Error; err != nil {
+				return errors.Wrap(err, "failed to remove operations")
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r repository) MarkGroupAbandoned(groupID string, at int64) error {
+	err := r.client.Exec(
+		`INSERT INTO abandoned_groups (group_id, abandoned_at) VALUES (?, ?) ON CONFLICT (group_id) DO NOTHING`,
+		groupID, at,
+	).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to mark group abandoned")
+	}
+
+	return nil
+}
+
+func (r repository) UnmarkGroupAbandoned(groupID string) error {
+	err := r.client.Exec(`DELETE FROM abandoned_groups WHERE group_id = ?`, groupID).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to unmark group abandoned")
+	}
+
+	return nil
+}
+
+func (r repository) GetAbandonedGroups(before int64) ([]string, error) {
+	groups := make([]string, 0)
+	err := r.client.Raw(`SELECT group_id FROM abandoned_groups WHERE abandoned_at < ?`, before).Scan(&groups).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select abandoned groups")
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,184 @@
+package adapters
+
+import (
+	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/logger"
+	"path/filepath"
+	"testing"
+)
+
+// testRepositories returns the sqlite repository on a migrated database next to the memory repository, both must
+// behave the same. Postgres shares the queries of the sqlite repository, so they stay within the syntax of both.
+func testRepositories(t *testing.T) map[string]Repository {
+	t.Helper()
+
+	cfg := &common.Config{
+		DatabaseDriver: common.DatabaseSQLite,
+		DatabasePath:   filepath.Join(t.TempDir(), "sync.db"),
+	}
+	db, err := NewDB(cfg)
+	require.NoError(t, err)
+	db.Logger = logger.Discard
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	m, err := NewMigrator(db)
+	require.NoError(t, err)
+	require.NoError(t, m.Up())
+
+	repo, err := NewRepository(cfg, db, "test")
+	require.NoError(t, err)
+
+	return map[string]Repository{
+		"sqlite": repo,
+		"memory": NewMemoryRepository(),
+	}
+}
+
+func operation(id, sql string) *proto.Operation {
+	return &proto.Operation{
+		Id:              id,
+		Type:            proto.OperationType_OPERATION_INSERT,
+		Sql:             sql,
+		RelatedEntities: []*proto.RelatedEntity{{Id: id, Name: "note"}},
+	}
+}
+
+// ON CONFLICT (group_id, client_operation_id) DO NOTHING
+func TestInsertDataSkipsStoredOperations(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			acks, err := repo.InsertData("phone", "group", []*proto.Operation{operation("1", "first"), {Sql: "anonymous"}}, []int64{1, 2})
+			require.NoError(t, err)
+			require.Len(t, acks, 1)
+
+			retried, err := repo.InsertData("phone", "group", []*proto.Operation{operation("1", "first")}, []int64{3})
+			require.NoError(t, err)
+			assert.Equal(t, acks, retried)
+
+			// the client id is unique within the group only
+			_, err = repo.InsertData("phone", "other", []*proto.Operation{operation("1", "first")}, []int64{4})
+			require.NoError(t, err)
+
+			operations, err := repo.GetAllData("group")
+			require.NoError(t, err)
+			require.Len(t, operations, 2)
+			assert.Equal(t, "first", operations[0].Sql)
+			assert.Equal(t, []common.RelatedEntity{{OperationID: operations[0].ID, EntityID: "1", EntityName: "note"}},
+				operations[0].Entities)
+		})
+	}
+}
+
+// INSERT ... ON CONFLICT (device_token) DO UPDATE ... RETURNING
+func TestUpdateDeviceCursor(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			acks, err := repo.InsertData("phone", "group", []*proto.Operation{operation("1", "first"), operation("2", "second")}, []int64{1, 2})
+			require.NoError(t, err)
+
+			cursor, err := repo.UpdateDeviceCursor("laptop", "alice", "group")
+			require.NoError(t, err)
+			assert.Equal(t, acks[1].Sequence, cursor)
+
+			// a cursor is never moved back
+			require.NoError(t, repo.AdvanceDeviceCursor("laptop", acks[0].Sequence))
+			stored, err := repo.GetCursor("laptop")
+			require.NoError(t, err)
+			assert.Equal(t, cursor, stored)
+
+			require.NoError(t, repo.AdvanceDeviceCursor("laptop", cursor+10))
+			stored, err = repo.GetCursor("laptop")
+			require.NoError(t, err)
+			assert.Equal(t, cursor+10, stored)
+
+			// the upsert moves the device to another group
+			cursor, err = repo.UpdateDeviceCursor("laptop", "alice", "alice")
+			require.NoError(t, err)
+			assert.Zero(t, cursor)
+			groupID, err := repo.GetGroupID("laptop", "alice")
+			require.NoError(t, err)
+			assert.Equal(t, "alice", groupID)
+		})
+	}
+}
+
+// snapshot operations are stored as a json document
+func TestSnapshot(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			missing, err := repo.GetSnapshot("group")
+			require.NoError(t, err)
+			assert.Nil(t, missing)
+
+			snapshot := &common.Snapshot{
+				GroupId:   "group",
+				Watermark: 2,
+				CreatedAt: 10,
+				Operations: []common.LoggedOperation{{
+					ID:            2,
+					OperationType: "OPERATION_INSERT",
+					Sql:           "INSERT INTO notes VALUES (?)",
+					Args:          `["note"]`,
+					HLC:           5,
+					Entities:      []common.RelatedEntity{{OperationID: 2, EntityID: "1", EntityName: "note"}},
+				}},
+			}
+			require.NoError(t, repo.SaveSnapshot(snapshot))
+			require.NoError(t, repo.PruneData("group", 2))
+
+			// a new snapshot keeps how far the log was pruned
+			snapshot.Watermark = 3
+			require.NoError(t, repo.SaveSnapshot(snapshot))
+
+			stored, err := repo.GetSnapshot("group")
+			require.NoError(t, err)
+			expected := *snapshot
+			expected.PrunedUpTo = 2
+			assert.Equal(t, &expected, stored)
+		})
+	}
+}
+
+func TestCopyOperations(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			acks, err := repo.InsertData("phone", "group", []*proto.Operation{operation("1", "first"), operation("2", "second")}, []int64{1, 2})
+			require.NoError(t, err)
+			require.NoError(t, repo.SaveFieldWrite(&common.FieldWrite{GroupId: "group", EntityName: "note", EntityId: "1", Field: "title", Timestamp: 2, Value: `"new"`}))
+			require.NoError(t, repo.SaveFieldWrite(&common.FieldWrite{GroupId: "alice", EntityName: "note", EntityId: "1", Field: "title", Timestamp: 1, Value: `"old"`}))
+			require.NoError(t, repo.SaveFieldWrite(&common.FieldWrite{GroupId: "group", EntityName: "note", EntityId: "1", Field: "body", Timestamp: 1, Value: `"old"`}))
+			require.NoError(t, repo.SaveFieldWrite(&common.FieldWrite{GroupId: "alice", EntityName: "note", EntityId: "1", Field: "body", Timestamp: 2, Value: `"new"`}))
+
+			copied, err := repo.CopyOperations("group", "alice")
+			require.NoError(t, err)
+			require.Len(t, copied, 2)
+			for i, op := range copied {
+				assert.Equal(t, acks[i].Sequence, op.FromID)
+				assert.Greater(t, op.ToID, acks[1].Sequence)
+			}
+
+			operations, err := repo.GetAllData("alice")
+			require.NoError(t, err)
+			require.Len(t, operations, 2)
+			assert.Equal(t, copied[0].ToID, int64(operations[0].ID))
+			assert.Equal(t, "first", operations[0].Sql)
+
+			// operations the group has already are not copied again
+			copied, err = repo.CopyOperations("group", "alice")
+			require.NoError(t, err)
+			assert.Empty(t, copied)
+
+			for _, field := range []string{"title", "body"} {
+				write, err := repo.GetFieldWrite("alice", "note", "1", field)
+				require.NoError(t, err)
+				assert.Equal(t, `"new"`, write.Value, field)
+			}
+		})
+	}
+}
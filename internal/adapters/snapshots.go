@@ -0,0 +1,129 @@
+package adapters
+
+import (
+	"encoding/json"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type snapshot struct {
+	GroupId    string `gorm:"primaryKey"`
+	Watermark  int64
+	CreatedAt  int64
+	PrunedUpTo int64
+	Operations string
+}
+
+func (r repository) GetCursor(deviceToken string) (int64, error) {
+	var cursor int64
+	err := r.client.Raw(
+		`SELECT coalesce((SELECT last_operation_id FROM device_tokens WHERE device_token = ?), 0)`, deviceToken,
+	).Scan(&cursor).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to select device cursor")
+	}
+
+	return cursor, nil
+}
+
+func (r repository) GetLog(groupID string, after int64) ([]common.LoggedOperation, error) {
+	return r.queryLog(`id`, `group_id = ? AND id > ?`, groupID, after)
+}
+
+func (r repository) GetSnapshot(groupID string) (*common.Snapshot, error) {
+	row := &snapshot{}
+	err := r.client.Where("group_id = ?", groupID).Take(row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select snapshot")
+	}
+
+	result := &common.Snapshot{
+		GroupId:    row.GroupId,
+		Watermark:  row.Watermark,
+		CreatedAt:  row.CreatedAt,
+		PrunedUpTo: row.PrunedUpTo,
+	}
+	if err = json.Unmarshal([]byte(row.Operations), &result.Operations); err != nil {
+		return nil, errors.Wrap(err, "failed to decode snapshot")
+	}
+
+	return result, nil
+}
+
+func (r repository) SaveSnapshot(s *common.Snapshot) error {
+	operations, err := json.Marshal(s.Operations)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode snapshot")
+	}
+
+	err = r.client.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "group_id"}},
+		// UpdateAll would keep created_at of the first snapshot, pruned_up_to is moved by PruneData only
+		DoUpdates: clause.AssignmentColumns([]string{"watermark", "created_at", "operations"}),
+	}).Create(&snapshot{
+		GroupId:    s.GroupId,
+		Watermark:  s.Watermark,
+		CreatedAt:  s.CreatedAt,
+		PrunedUpTo: s.PrunedUpTo,
+		Operations: string(operations),
+	}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to save snapshot")
+	}
+
+	return nil
+}
+
+func (r repository) GetGroupsToCompact(threshold int) ([]string, error) {
+	groups := make([]string, 0)
+	err := r.client.Raw(
+		`SELECT o.group_id
+				FROM operations o
+				LEFT JOIN snapshots s ON s.group_id = o.group_id
+				WHERE o.id > coalesce(s.watermark, 0)
+				GROUP BY o.group_id
+				HAVING count(*) >= ?`,
+		threshold,
+	).Scan(&groups).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select groups to compact")
+	}
+
+	return groups, nil
+}
+
+// PruneData removes operations of the group up to the given id, which must be covered by the group snapshot.
+func (r repository) PruneData(groupID string, upTo int64) error {
+	return r.client.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`DELETE FROM operations WHERE group_id = ? AND id <= ?`, groupID, upTo).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to remove operations")
+		}
+
+		err = tx.Exec(`UPDATE snapshots SET pruned_up_to = ? WHERE group_id = ?`, upTo, groupID).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to update snapshot")
+		}
+
+		return nil
+	})
+}
+
+func (r repository) GetGroupsToPrune() ([]string, error) {
+	groups := make([]string, 0)
+	err := r.client.Raw(
+		`SELECT s.group_id
+				FROM snapshots s
+				WHERE EXISTS (SELECT null FROM operations o WHERE o.group_id = s.group_id AND o.id <= s.watermark)`,
+	).Scan(&groups).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select groups to prune")
+	}
+
+	return groups, nil
+}
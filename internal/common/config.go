@@ -1,12 +1,65 @@
 package common
 
-import "github.com/caarlos0/env"
+import (
+	"github.com/caarlos0/env"
+	"time"
+)
+
+const (
+	GroupMutexMemory   = "memory"
+	GroupMutexPostgres = "postgres"
+
+	DatabasePostgres = "postgres"
+	DatabaseSQLite   = "sqlite"
+	DatabaseMemory   = "memory"
+
+	NotifierFCM = "fcm"
+	NotifierLog = "log"
+)
 
 type Config struct {
 	FirebaseProjectID string `env:"FIREBASE_PROJECT_ID" envDefault:""`
-	DatabaseFQDN      string `env:"DATABASE_FQDN"`
-	Workers           int    `env:"WORKERS" envDefault:"5"`
-	WorkerPoolBuffer  int    `env:"WORKER_POOL_BUFFER" envDefault:"10"`
+	// DatabaseDriver is "postgres" which connects to DatabaseFQDN, "sqlite" which stores data in DatabasePath
+	// or "memory" which loses data on restart
+	DatabaseDriver   string `env:"DATABASE_DRIVER" envDefault:"postgres"`
+	DatabaseFQDN     string `env:"DATABASE_FQDN"`
+	DatabasePath     string `env:"DATABASE_PATH" envDefault:"sync.db"`
+	Workers          int    `env:"WORKERS" envDefault:"5"`
+	WorkerPoolBuffer int    `env:"WORKER_POOL_BUFFER" envDefault:"10"`
+	// MaxUploadBatches and MaxUploadOperations bound a single SyncData upload, which is buffered until it is committed.
+	// SyncData announces them in its response header, so clients split larger uploads
+	MaxUploadBatches    int `env:"MAX_UPLOAD_BATCHES" envDefault:"100"`
+	MaxUploadOperations int `env:"MAX_UPLOAD_OPERATIONS" envDefault:"10000"`
+	// GroupMutex is "memory" for a single replica or "postgres" to share group locks between replicas
+	GroupMutex string `env:"GROUP_MUTEX" envDefault:"memory"`
+	// LockTimeout bounds the wait for a group lock, zero makes a busy group fail immediately
+	LockTimeout time.Duration `env:"LOCK_TIMEOUT" envDefault:"30s"`
+	// GroupMutexReportInterval is how often the number of groups held by the group mutex is logged, zero disables it
+	GroupMutexReportInterval time.Duration `env:"GROUP_MUTEX_REPORT_INTERVAL" envDefault:"5m"`
+	// MigrateOnStart applies pending schema migrations before the server starts
+	MigrateOnStart bool `env:"MIGRATE_ON_START" envDefault:"true"`
+	// CompactionInterval is how often groups are compacted into snapshots, zero disables compaction
+	CompactionInterval time.Duration `env:"COMPACTION_INTERVAL" envDefault:"1h"`
+	// CompactionThreshold is the number of new operations that makes a group worth compacting
+	CompactionThreshold int `env:"COMPACTION_THRESHOLD" envDefault:"10000"`
+	// RetentionInterval is how often operations synced by every device of a group are pruned, zero disables pruning
+	RetentionInterval time.Duration `env:"RETENTION_INTERVAL" envDefault:"1h"`
+	// StaleDeviceHorizon is the inactivity after which a device no longer holds back pruning, zero keeps every device
+	StaleDeviceHorizon time.Duration `env:"STALE_DEVICE_HORIZON" envDefault:"2160h"`
+	// GroupGracePeriod keeps data of a group without devices joinable, zero removes it as the last device leaves
+	GroupGracePeriod time.Duration `env:"GROUP_GRACE_PERIOD" envDefault:"168h"`
+	// GroupCleanupInterval is how often abandoned groups past the grace period are removed
+	GroupCleanupInterval time.Duration `env:"GROUP_CLEANUP_INTERVAL" envDefault:"1h"`
+	// InviteTTL is the lifetime of invites created without an explicit one
+	InviteTTL time.Duration `env:"INVITE_TTL" envDefault:"72h"`
+	// LegacyGroupJoin lets clients without invites join a group by its id as editors, anyone knowing the id can join
+	LegacyGroupJoin bool `env:"LEGACY_GROUP_JOIN" envDefault:"false"`
+	// Notifier is "fcm" which wakes up devices with firebase cloud messaging or "log" which only logs notifications
+	Notifier string `env:"NOTIFIER" envDefault:"log"`
+	// NotifyDelay is how long changes of a group are collected before its devices are notified once about all of them
+	NotifyDelay time.Duration `env:"NOTIFY_DELAY" envDefault:"10s"`
+	// ClockMaxDrift is how far ahead of the server a client clock may be, zero accepts any client clock
+	ClockMaxDrift time.Duration `env:"CLOCK_MAX_DRIFT" envDefault:"5m"`
 }
 
 func NewConfig() (*Config, error) {
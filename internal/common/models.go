@@ -1,13 +1,25 @@
 package common
 
+const (
+	// RoleOwner manages invites and members, the user of a personal group owns it without a member record
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	// RoleViewer downloads operations but can't upload them
+	RoleViewer = "viewer"
+)
+
 type Operation struct {
-	ID            int `gorm:"primaryKey"`
-	DeviceToken   string
-	GroupId       string
-	OperationType string
-	Sql           string
-	Args          string
-	CreatedAt     int64
+	ID int `gorm:"primaryKey"`
+	// ClientOperationId is generated by the client and unique within the group, nil for clients that don't send it
+	ClientOperationId *string
+	DeviceToken       string
+	GroupId           string
+	OperationType     string
+	Sql               string
+	Args              string
+	CreatedAt         int64
+	// HLC is the hybrid logical clock timestamp the server stamped the operation with, zero for older operations
+	HLC int64
 }
 
 type RelatedEntity struct {
@@ -15,3 +27,75 @@ type RelatedEntity struct {
 	EntityID    string
 	EntityName  string
 }
+
+type DeviceToken struct {
+	DeviceToken     string `gorm:"primaryKey"`
+	UserId          string
+	GroupId         string
+	LastSync        int64
+	LastOperationId int64
+}
+
+// CopiedOperation maps an operation to its copy in another group
+type CopiedOperation struct {
+	FromID int64
+	ToID   int64
+}
+
+// LoggedOperation is an operation of the group log together with the entities it touches
+type LoggedOperation struct {
+	ID            int
+	OperationType string
+	Sql           string
+	Args          string
+	HLC           int64
+	Entities      []RelatedEntity `gorm:"-"`
+}
+
+// Snapshot is the compacted log of a group up to Watermark, the id of the last operation it covers
+type Snapshot struct {
+	GroupId   string
+	Watermark int64
+	CreatedAt int64
+	// PrunedUpTo is the id of the last operation removed from the log, the snapshot is the only copy of them
+	PrunedUpTo int64
+	Operations []LoggedOperation
+}
+
+// Invite lets its holder join GroupId until ExpiresAt, a single use invite is removed once redeemed
+type Invite struct {
+	Code      string `gorm:"primaryKey"`
+	GroupId   string
+	CreatedBy string
+	CreatedAt int64
+	ExpiresAt int64
+	SingleUse bool
+	// Role is granted to users joining with the invite
+	Role string
+}
+
+type Member struct {
+	GroupId  string `gorm:"primaryKey"`
+	UserId   string `gorm:"primaryKey"`
+	Role     string
+	JoinedAt int64
+}
+
+// MemberDevices is a member of a group with the devices synced to it
+type MemberDevices struct {
+	UserId   string
+	Role     string
+	JoinedAt int64
+	Devices  []DeviceToken
+}
+
+// FieldWrite is the latest write of an entity field in a group. Writes are ordered by Timestamp and then by Value
+// compared byte-wise, so every replica and client picks the same winner
+type FieldWrite struct {
+	GroupId    string `gorm:"primaryKey"`
+	EntityName string `gorm:"primaryKey"`
+	EntityId   string `gorm:"primaryKey"`
+	Field      string `gorm:"primaryKey"`
+	Timestamp  int64
+	Value      string
+}
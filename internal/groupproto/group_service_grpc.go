@@ -0,0 +1,183 @@
+package groupproto
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// The gRPC bindings of GroupService take the shape protoc-gen-go-grpc generates, group_service.pb.go is generated by
+// protoc-gen-go from group_service.proto.
+
+const groupServiceName = "sync.GroupService"
+
+type GroupServiceServer interface {
+	CreateInvite(ctx context.Context, request *CreateInviteRequest) (*Invite, error)
+	GetInvites(ctx context.Context, request *emptypb.Empty) (*Invites, error)
+	RevokeInvite(ctx context.Context, request *RevokeInviteRequest) (*emptypb.Empty, error)
+	SetMemberRole(ctx context.Context, request *SetMemberRoleRequest) (*emptypb.Empty, error)
+	ListMembers(ctx context.Context, request *emptypb.Empty) (*Members, error)
+	RemoveMember(ctx context.Context, request *RemoveMemberRequest) (*emptypb.Empty, error)
+	TransferOwnership(ctx context.Context, request *TransferOwnershipRequest) (*emptypb.Empty, error)
+	Subscribe(request *emptypb.Empty, stream GroupService_SubscribeServer) error
+}
+
+type GroupService_SubscribeServer interface {
+	Send(operations *PushedOperations) error
+	grpc.ServerStream
+}
+
+type groupServiceSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (s *groupServiceSubscribeServer) Send(operations *PushedOperations) error {
+	return s.ServerStream.SendMsg(operations)
+}
+
+var GroupService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: groupServiceName,
+	HandlerType: (*GroupServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod("CreateInvite", GroupServiceServer.CreateInvite),
+		unaryMethod("GetInvites", GroupServiceServer.GetInvites),
+		unaryMethod("RevokeInvite", GroupServiceServer.RevokeInvite),
+		unaryMethod("SetMemberRole", GroupServiceServer.SetMemberRole),
+		unaryMethod("ListMembers", GroupServiceServer.ListMembers),
+		unaryMethod("RemoveMember", GroupServiceServer.RemoveMember),
+		unaryMethod("TransferOwnership", GroupServiceServer.TransferOwnership),
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Subscribe",
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				request := new(emptypb.Empty)
+				if err := stream.RecvMsg(request); err != nil {
+					return err
+				}
+
+				return srv.(GroupServiceServer).Subscribe(request, &groupServiceSubscribeServer{stream})
+			},
+			ServerStreams: true,
+		},
+	},
+	Metadata: "group_service.proto",
+}
+
+// unaryMethod does what protoc-gen-go-grpc generates for a unary method.
+func unaryMethod[Req any, Resp any](name string, call func(GroupServiceServer, context.Context, *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			request := new(Req)
+			if err := dec(request); err != nil {
+				return nil, err
+			}
+
+			handler := func(ctx context.Context, request any) (any, error) {
+				return call(srv.(GroupServiceServer), ctx, request.(*Req))
+			}
+			if interceptor == nil {
+				return handler(ctx, request)
+			}
+
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + groupServiceName + "/" + name,
+			}
+
+			return interceptor(ctx, request, info, handler)
+		},
+	}
+}
+
+type GroupServiceClient interface {
+	CreateInvite(ctx context.Context, request *CreateInviteRequest, opts ...grpc.CallOption) (*Invite, error)
+	GetInvites(ctx context.Context, request *emptypb.Empty, opts ...grpc.CallOption) (*Invites, error)
+	RevokeInvite(ctx context.Context, request *RevokeInviteRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	SetMemberRole(ctx context.Context, request *SetMemberRoleRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	ListMembers(ctx context.Context, request *emptypb.Empty, opts ...grpc.CallOption) (*Members, error)
+	RemoveMember(ctx context.Context, request *RemoveMemberRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	TransferOwnership(ctx context.Context, request *TransferOwnershipRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Subscribe(ctx context.Context, request *emptypb.Empty, opts ...grpc.CallOption) (GroupService_SubscribeClient, error)
+}
+
+type GroupService_SubscribeClient interface {
+	Recv() (*PushedOperations, error)
+	grpc.ClientStream
+}
+
+type groupServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGroupServiceClient(cc grpc.ClientConnInterface) GroupServiceClient {
+	return &groupServiceClient{cc}
+}
+
+func (c *groupServiceClient) CreateInvite(ctx context.Context, request *CreateInviteRequest, opts ...grpc.CallOption) (*Invite, error) {
+	return invoke[Invite](ctx, c.cc, "CreateInvite", request, opts)
+}
+
+func (c *groupServiceClient) GetInvites(ctx context.Context, request *emptypb.Empty, opts ...grpc.CallOption) (*Invites, error) {
+	return invoke[Invites](ctx, c.cc, "GetInvites", request, opts)
+}
+
+func (c *groupServiceClient) RevokeInvite(ctx context.Context, request *RevokeInviteRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return invoke[emptypb.Empty](ctx, c.cc, "RevokeInvite", request, opts)
+}
+
+func (c *groupServiceClient) SetMemberRole(ctx context.Context, request *SetMemberRoleRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return invoke[emptypb.Empty](ctx, c.cc, "SetMemberRole", request, opts)
+}
+
+func (c *groupServiceClient) ListMembers(ctx context.Context, request *emptypb.Empty, opts ...grpc.CallOption) (*Members, error) {
+	return invoke[Members](ctx, c.cc, "ListMembers", request, opts)
+}
+
+func (c *groupServiceClient) RemoveMember(ctx context.Context, request *RemoveMemberRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return invoke[emptypb.Empty](ctx, c.cc, "RemoveMember", request, opts)
+}
+
+func (c *groupServiceClient) TransferOwnership(ctx context.Context, request *TransferOwnershipRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return invoke[emptypb.Empty](ctx, c.cc, "TransferOwnership", request, opts)
+}
+
+func (c *groupServiceClient) Subscribe(ctx context.Context, request *emptypb.Empty, opts ...grpc.CallOption) (GroupService_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GroupService_ServiceDesc.Streams[0], "/"+groupServiceName+"/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &groupServiceSubscribeClient{stream}
+	if err = client.SendMsg(request); err != nil {
+		return nil, err
+	}
+	if err = client.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+type groupServiceSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (c *groupServiceSubscribeClient) Recv() (*PushedOperations, error) {
+	operations := new(PushedOperations)
+	if err := c.ClientStream.RecvMsg(operations); err != nil {
+		return nil, err
+	}
+
+	return operations, nil
+}
+
+func invoke[Resp any](ctx context.Context, cc grpc.ClientConnInterface, method string, request any, opts []grpc.CallOption) (*Resp, error) {
+	response := new(Resp)
+	if err := cc.Invoke(ctx, "/"+groupServiceName+"/"+method, request, response, opts...); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
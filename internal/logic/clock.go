@@ -0,0 +1,76 @@
+package logic
+
+import (
+	"github.com/Gregmus2/sync-service/internal/common"
+	"sync"
+	"time"
+)
+
+// hlcLogicalBits is the width of the logical counter in the low bits of a timestamp, the high bits keep
+// milliseconds since the epoch. A counter overflow carries into the milliseconds, the order stays intact.
+const hlcLogicalBits = 16
+
+// hybridClock is a hybrid logical clock: its timestamps follow the wall clock, but never go back and always
+// exceed every timestamp observed from clients and other replicas, so they order causally related operations
+// whatever clocks of the pods and devices show.
+type hybridClock struct {
+	maxDrift time.Duration
+	now      func() time.Time
+
+	mx   sync.Mutex
+	last int64
+}
+
+func NewClock(cfg *common.Config) Clock {
+	return &hybridClock{
+		maxDrift: cfg.ClockMaxDrift,
+		now:      time.Now,
+	}
+}
+
+func (c *hybridClock) Now() int64 {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.tick(c.physical())
+}
+
+func (c *hybridClock) Update(remote int64) (int64, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	physical := c.physical()
+	// a clock far in the future would drag every later timestamp along with it
+	if c.maxDrift > 0 && remote > physical+c.maxDrift.Milliseconds()<<hlcLogicalBits {
+		return 0, ErrInvalidClock
+	}
+	if remote >= physical {
+		physical = remote + 1
+	}
+
+	return c.tick(physical), nil
+}
+
+func (c *hybridClock) Observe(stamped int64) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if stamped > c.last {
+		c.last = stamped
+	}
+}
+
+// tick returns the next timestamp that is not before the given one.
+func (c *hybridClock) tick(at int64) int64 {
+	if at > c.last {
+		c.last = at
+	} else {
+		c.last++
+	}
+
+	return c.last
+}
+
+func (c *hybridClock) physical() int64 {
+	return c.now().UnixMilli() << hlcLogicalBits
+}
@@ -0,0 +1,87 @@
+package logic
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// newTestClock returns a clock whose wall clock shows the returned time until the test changes it.
+func newTestClock(maxDrift time.Duration) (*hybridClock, *time.Time) {
+	wall := time.UnixMilli(1_700_000_000_000)
+
+	return &hybridClock{maxDrift: maxDrift, now: func() time.Time { return wall }}, &wall
+}
+
+func TestClockNowIsMonotonic(t *testing.T) {
+	c, wall := newTestClock(time.Minute)
+
+	first := c.Now()
+	assert.Equal(t, wall.UnixMilli(), first>>hlcLogicalBits)
+
+	// a wall clock that stands still or goes back only moves the logical counter
+	second := c.Now()
+	assert.Equal(t, first+1, second)
+	*wall = wall.Add(-time.Second)
+	assert.Equal(t, second+1, c.Now())
+
+	*wall = wall.Add(time.Hour)
+	assert.Equal(t, wall.UnixMilli()<<hlcLogicalBits, c.Now())
+}
+
+func TestClockCounterOverflowCarriesIntoMilliseconds(t *testing.T) {
+	c, wall := newTestClock(time.Minute)
+	physical := wall.UnixMilli() << hlcLogicalBits
+	c.Observe(physical + 1<<hlcLogicalBits - 1)
+
+	next := c.Now()
+	assert.Equal(t, wall.UnixMilli()+1, next>>hlcLogicalBits)
+	assert.Equal(t, int64(0), next&(1<<hlcLogicalBits-1))
+	assert.Greater(t, c.Now(), next)
+}
+
+func TestClockUpdateMovesPastRemote(t *testing.T) {
+	c, wall := newTestClock(time.Minute)
+	ahead := wall.Add(time.Second).UnixMilli() << hlcLogicalBits
+
+	stamp, err := c.Update(ahead)
+	require.NoError(t, err)
+	assert.Equal(t, ahead+1, stamp)
+	assert.Greater(t, c.Now(), stamp)
+
+	// a remote clock behind the server doesn't hold it back
+	stamp, err = c.Update(0)
+	require.NoError(t, err)
+	assert.Greater(t, stamp, ahead)
+}
+
+func TestClockUpdateRejectsDrift(t *testing.T) {
+	c, wall := newTestClock(time.Minute)
+	before := c.Now()
+
+	_, err := c.Update(wall.Add(2*time.Minute).UnixMilli() << hlcLogicalBits)
+	assert.ErrorIs(t, err, ErrInvalidClock)
+	// the rejected clock is not observed
+	assert.Equal(t, before+1, c.Now())
+
+	_, err = c.Update(wall.Add(time.Minute).UnixMilli() << hlcLogicalBits)
+	assert.NoError(t, err)
+
+	// zero drift accepts any client clock
+	c, wall = newTestClock(0)
+	_, err = c.Update(wall.Add(24*time.Hour).UnixMilli() << hlcLogicalBits)
+	assert.NoError(t, err)
+}
+
+func TestClockObserveTrustsReplicas(t *testing.T) {
+	c, wall := newTestClock(time.Minute)
+	stamped := wall.Add(time.Hour).UnixMilli() << hlcLogicalBits
+
+	c.Observe(stamped)
+	assert.Equal(t, stamped+1, c.Now())
+
+	// an older timestamp doesn't move the clock back
+	c.Observe(0)
+	assert.Equal(t, stamped+2, c.Now())
+}
@@ -0,0 +1,120 @@
+package logic
+
+import (
+	"context"
+	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"time"
+)
+
+type compactor struct {
+	mx        GroupMutex
+	repo      adapters.Repository
+	threshold int
+	logger    *logrus.Entry
+}
+
+func NewCompactor(cfg *common.Config, mx GroupMutex, repo adapters.Repository, logger *logrus.Entry) Compactor {
+	return &compactor{
+		mx:        mx,
+		repo:      repo,
+		threshold: cfg.CompactionThreshold,
+		logger:    logger,
+	}
+}
+
+// ScheduleCompaction compacts groups with enough new operations every CompactionInterval.
+func ScheduleCompaction(lc fx.Lifecycle, cfg *common.Config, c Compactor, logger *logrus.Entry) {
+	schedule(lc, cfg.CompactionInterval, c.CompactAll, logger.WithField("job", "compaction"))
+}
+
+func (c *compactor) CompactAll(ctx context.Context) error {
+	groups, err := c.repo.GetGroupsToCompact(c.threshold)
+	if err != nil {
+		return errors.Wrap(err, "failed to get groups to compact")
+	}
+
+	for _, groupID := range groups {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err = c.Compact(groupID); err != nil {
+			c.logger.WithError(err).WithField("group_id", groupID).Error("failed to compact group")
+		}
+	}
+
+	return nil
+}
+
+func (c *compactor) Compact(groupID string) error {
+	// a busy group is compacted on the next run instead of delaying syncs
+	locked, err := c.mx.TryLock(groupID)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock group")
+	}
+	if !locked {
+		return nil
+	}
+	defer func() {
+		if err := c.mx.Unlock(groupID); err != nil {
+			c.logger.WithError(err).WithField("group_id", groupID).Error("failed to unlock group")
+		}
+	}()
+
+	// rows superseded for every device of the group are removed from the log itself
+	seen, err := c.repo.GetMaxCursor(groupID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get max cursor")
+	}
+
+	log, err := c.repo.GetAllData(groupID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get log")
+	}
+
+	dropped := superseded(log, seen)
+	if len(dropped) > 0 {
+		ids := make([]int, 0, len(dropped))
+		for id := range dropped {
+			ids = append(ids, id)
+		}
+		if err = c.repo.RemoveOperations(ids); err != nil {
+			return errors.Wrap(err, "failed to remove superseded operations")
+		}
+	}
+
+	snapshot, err := c.repo.GetSnapshot(groupID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get snapshot")
+	}
+
+	var watermark int64
+	operations := make([]common.LoggedOperation, 0)
+	if snapshot != nil {
+		watermark = snapshot.Watermark
+		operations = append(operations, snapshot.Operations...)
+	}
+
+	tail := make([]common.LoggedOperation, 0)
+	for _, op := range log {
+		if int64(op.ID) > watermark {
+			tail = append(tail, op)
+		}
+	}
+	if len(tail) == 0 {
+		return nil
+	}
+
+	// the tail still has the removed operations, nobody bootstrapping from the snapshot has any of its rows,
+	// so a delete whose insert was removed above goes away as well
+	return c.repo.SaveSnapshot(&common.Snapshot{
+		GroupId:    groupID,
+		Watermark:  int64(tail[len(tail)-1].ID),
+		CreatedAt:  time.Now().UnixMicro(),
+		Operations: squash(append(operations, tail...), 0),
+	})
+}
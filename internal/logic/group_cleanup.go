@@ -0,0 +1,109 @@
+package logic
+
+import (
+	"context"
+	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"time"
+)
+
+type groupCleaner struct {
+	mx          GroupMutex
+	repo        adapters.Repository
+	gracePeriod time.Duration
+	logger      *logrus.Entry
+}
+
+func NewGroupCleaner(cfg *common.Config, mx GroupMutex, repo adapters.Repository, logger *logrus.Entry) GroupCleaner {
+	return &groupCleaner{
+		mx:          mx,
+		repo:        repo,
+		gracePeriod: cfg.GroupGracePeriod,
+		logger:      logger,
+	}
+}
+
+// ScheduleGroupCleanup deletes groups abandoned longer than GroupGracePeriod every GroupCleanupInterval.
+func ScheduleGroupCleanup(lc fx.Lifecycle, cfg *common.Config, c GroupCleaner, logger *logrus.Entry) {
+	schedule(lc, cfg.GroupCleanupInterval, c.CleanAll, logger.WithField("job", "group_cleanup"))
+}
+
+func (c *groupCleaner) CleanAll(ctx context.Context) error {
+	if err := c.repo.RemoveExpiredInvites(time.Now().UnixMicro()); err != nil {
+		return errors.Wrap(err, "failed to remove expired invites")
+	}
+
+	groups, err := c.repo.GetAbandonedGroups(time.Now().Add(-c.gracePeriod).UnixMicro())
+	if err != nil {
+		return errors.Wrap(err, "failed to get abandoned groups")
+	}
+
+	for _, groupID := range groups {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err = c.Clean(groupID); err != nil {
+			c.logger.WithError(err).WithField("group_id", groupID).Error("failed to clean group")
+		}
+	}
+
+	return nil
+}
+
+func (c *groupCleaner) Clean(groupID string) error {
+	// a busy group is cleaned on the next run instead of delaying syncs
+	locked, err := c.mx.TryLock(groupID)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock group")
+	}
+	if !locked {
+		return nil
+	}
+	defer func() {
+		if err := c.mx.Unlock(groupID); err != nil {
+			c.logger.WithError(err).WithField("group_id", groupID).Error("failed to unlock group")
+		}
+	}()
+
+	return c.repo.WithTx(func(repo adapters.Repository) error {
+		devices, err := repo.GetGroupDevices(groupID)
+		if err != nil {
+			return errors.Wrap(err, "failed to get group devices")
+		}
+
+		// somebody joined during the grace period
+		if len(devices) > 0 {
+			return repo.UnmarkGroupAbandoned(groupID)
+		}
+
+		if err = repo.RemoveData(groupID); err != nil {
+			return errors.Wrap(err, "failed to remove data")
+		}
+
+		c.logger.WithField("group_id", groupID).Info("removed abandoned group")
+
+		return nil
+	})
+}
+
+// abandonIfEmpty removes data of a group without devices, with a grace period the group is only marked
+// abandoned and stays joinable until the cleanup job removes it.
+func abandonIfEmpty(repo adapters.Repository, groupID string, gracePeriod time.Duration) error {
+	devices, err := repo.GetGroupDevices(groupID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get group devices")
+	}
+	if len(devices) > 0 {
+		return nil
+	}
+
+	if gracePeriod == 0 {
+		return repo.RemoveData(groupID)
+	}
+
+	return repo.MarkGroupAbandoned(groupID, time.Now().UnixMicro())
+}
@@ -1,25 +1,209 @@
 package logic
 
-import "sync"
+import (
+	"context"
+	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"sort"
+	"sync"
+)
+
+type singleGroupMutex interface {
+	Lock(ctx context.Context, groupID string) error
+	TryLock(groupID string) (bool, error)
+	Unlock(groupID string) error
+	Size() int
+}
+
+// orderedMutex locks several groups on top of a single group mutex.
+type orderedMutex struct {
+	singleGroupMutex
+}
 
 type groupMutex struct {
-	mutexes map[string]*sync.Mutex
+	mx      sync.Mutex
+	mutexes map[string]*groupLock
 }
 
-func NewGroupMutex() GroupMutex {
-	return &groupMutex{
-		mutexes: make(map[string]*sync.Mutex),
+// groupLock is a semaphore with capacity 1, so waiting for it can be cancelled. The entry is
+// dropped as soon as nobody holds or waits for it.
+type groupLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func NewGroupMutex(cfg *common.Config, lock adapters.AdvisoryLock) (GroupMutex, error) {
+	switch cfg.GroupMutex {
+	case common.GroupMutexMemory:
+		return &orderedMutex{&groupMutex{
+			mutexes: make(map[string]*groupLock),
+		}}, nil
+	case common.GroupMutexPostgres:
+		if cfg.DatabaseDriver != common.DatabasePostgres {
+			return nil, errors.Errorf("group mutex %q requires the postgres database driver", cfg.GroupMutex)
+		}
+
+		return &orderedMutex{lock}, nil
+	default:
+		return nil, errors.Errorf("unknown group mutex %q", cfg.GroupMutex)
 	}
 }
 
-func (g groupMutex) Lock(groupID string) {
-	if _, ok := g.mutexes[groupID]; !ok {
-		g.mutexes[groupID] = &sync.Mutex{}
+// ReportGroupMutexSize logs the number of groups held or awaited every GroupMutexReportInterval, a size that only
+// grows means group locks leak.
+func ReportGroupMutexSize(lc fx.Lifecycle, cfg *common.Config, mx GroupMutex, logger *logrus.Entry) {
+	logger = logger.WithField("job", "group_mutex_report")
+	schedule(lc, cfg.GroupMutexReportInterval, func(context.Context) error {
+		logger.WithField("groups", mx.Size()).Info("group mutex size")
+
+		return nil
+	}, logger)
+}
+
+func (m *orderedMutex) LockMany(ctx context.Context, groupIDs ...string) error {
+	groupIDs = canonicalOrder(groupIDs)
+	for i, groupID := range groupIDs {
+		if err := m.Lock(ctx, groupID); err != nil {
+			_ = m.unlockAll(groupIDs[:i])
+
+			return err
+		}
 	}
 
-	g.mutexes[groupID].Lock()
+	return nil
 }
 
-func (g groupMutex) Unlock(groupID string) {
-	g.mutexes[groupID].Unlock()
+func (m *orderedMutex) TryLockMany(groupIDs ...string) (bool, error) {
+	groupIDs = canonicalOrder(groupIDs)
+	for i, groupID := range groupIDs {
+		locked, err := m.TryLock(groupID)
+		if err != nil || !locked {
+			_ = m.unlockAll(groupIDs[:i])
+
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (m *orderedMutex) UnlockMany(groupIDs ...string) error {
+	return m.unlockAll(canonicalOrder(groupIDs))
+}
+
+// unlockAll releases groups in reverse order and reports the first failure.
+func (m *orderedMutex) unlockAll(groupIDs []string) error {
+	var firstErr error
+	for i := len(groupIDs) - 1; i >= 0; i-- {
+		if err := m.Unlock(groupIDs[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// canonicalOrder returns sorted group ids without duplicates, so the same group is never locked twice.
+func canonicalOrder(groupIDs []string) []string {
+	unique := make([]string, 0, len(groupIDs))
+	seen := make(map[string]struct{}, len(groupIDs))
+	for _, groupID := range groupIDs {
+		if _, ok := seen[groupID]; ok {
+			continue
+		}
+
+		seen[groupID] = struct{}{}
+		unique = append(unique, groupID)
+	}
+	sort.Strings(unique)
+
+	return unique
+}
+
+func (g *groupMutex) Lock(ctx context.Context, groupID string) error {
+	l := g.acquire(groupID)
+
+	select {
+	case l.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		g.release(groupID)
+
+		return ctx.Err()
+	}
+}
+
+func (g *groupMutex) TryLock(groupID string) (bool, error) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	l, ok := g.mutexes[groupID]
+	if !ok {
+		l = &groupLock{ch: make(chan struct{}, 1)}
+		g.mutexes[groupID] = l
+	}
+
+	select {
+	case l.ch <- struct{}{}:
+		l.refs++
+
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func (g *groupMutex) Unlock(groupID string) error {
+	g.mx.Lock()
+	l, ok := g.mutexes[groupID]
+	g.mx.Unlock()
+
+	if !ok {
+		return errors.Errorf("group %s is not locked", groupID)
+	}
+
+	select {
+	case <-l.ch:
+	default:
+		return errors.Errorf("group %s is not locked", groupID)
+	}
+
+	g.release(groupID)
+
+	return nil
+}
+
+func (g *groupMutex) Size() int {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	return len(g.mutexes)
+}
+
+func (g *groupMutex) acquire(groupID string) *groupLock {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	l, ok := g.mutexes[groupID]
+	if !ok {
+		l = &groupLock{ch: make(chan struct{}, 1)}
+		g.mutexes[groupID] = l
+	}
+	l.refs++
+
+	return l
+}
+
+func (g *groupMutex) release(groupID string) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	l := g.mutexes[groupID]
+	l.refs--
+	if l.refs == 0 {
+		delete(g.mutexes, groupID)
+	}
 }
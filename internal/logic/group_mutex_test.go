@@ -0,0 +1,158 @@
+package logic
+
+import (
+	"context"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewGroupMutexRejectsUnknownMutex(t *testing.T) {
+	_, err := NewGroupMutex(&common.Config{GroupMutex: "redis"}, nil)
+	assert.Error(t, err)
+}
+
+// advisory locks exist only in postgres, sqlite and memory databases are served by a single replica
+func TestPostgresGroupMutexRequiresPostgres(t *testing.T) {
+	for _, driver := range []string{common.DatabaseSQLite, common.DatabaseMemory} {
+		_, err := NewGroupMutex(&common.Config{GroupMutex: common.GroupMutexPostgres, DatabaseDriver: driver}, nil)
+		assert.Error(t, err, driver)
+	}
+}
+
+func newMemoryGroupMutex(t *testing.T) GroupMutex {
+	t.Helper()
+
+	mx, err := NewGroupMutex(&common.Config{GroupMutex: common.GroupMutexMemory}, nil)
+	require.NoError(t, err)
+
+	return mx
+}
+
+func TestGroupMutexEvictsIdleGroups(t *testing.T) {
+	mx := newMemoryGroupMutex(t)
+	ctx := context.Background()
+
+	require.NoError(t, mx.Lock(ctx, "a"))
+	locked, err := mx.TryLock("b")
+	require.NoError(t, err)
+	require.True(t, locked)
+	assert.Equal(t, 2, mx.Size())
+
+	// a failed try and an abandoned wait don't keep the group
+	locked, err = mx.TryLock("a")
+	require.NoError(t, err)
+	assert.False(t, locked)
+	cancelled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, mx.Lock(cancelled, "a"), context.DeadlineExceeded)
+	assert.Equal(t, 2, mx.Size())
+
+	require.NoError(t, mx.Unlock("a"))
+	require.NoError(t, mx.Unlock("b"))
+	assert.Equal(t, 0, mx.Size())
+	assert.Error(t, mx.Unlock("a"))
+}
+
+func TestGroupMutexExcludesConcurrentHolders(t *testing.T) {
+	mx := newMemoryGroupMutex(t)
+
+	var (
+		wg      sync.WaitGroup
+		holders int
+		counter int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				if !assert.NoError(t, mx.Lock(context.Background(), "group")) {
+					return
+				}
+
+				holders++
+				assert.Equal(t, 1, holders)
+				counter++
+				holders--
+
+				assert.NoError(t, mx.Unlock("group"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 20*50, counter)
+	assert.Equal(t, 0, mx.Size())
+}
+
+func TestCanonicalOrder(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c"}, canonicalOrder([]string{"c", "a", "b", "a"}))
+	assert.Empty(t, canonicalOrder(nil))
+}
+
+func TestLockManyLocksEveryGroupOnce(t *testing.T) {
+	mx := newMemoryGroupMutex(t)
+
+	require.NoError(t, mx.LockMany(context.Background(), "b", "a", "b"))
+	assert.Equal(t, 2, mx.Size())
+
+	locked, err := mx.TryLockMany("a")
+	require.NoError(t, err)
+	assert.False(t, locked)
+
+	require.NoError(t, mx.UnlockMany("a", "b", "a"))
+	assert.Equal(t, 0, mx.Size())
+}
+
+func TestLockManyReleasesLockedGroupsOnFailure(t *testing.T) {
+	mx := newMemoryGroupMutex(t)
+	require.NoError(t, mx.Lock(context.Background(), "b"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, mx.LockMany(ctx, "c", "b", "a"), context.DeadlineExceeded)
+
+	locked, err := mx.TryLockMany("a", "b")
+	require.NoError(t, err)
+	assert.False(t, locked)
+
+	// neither attempt kept "a"
+	assert.Equal(t, 1, mx.Size())
+	locked, err = mx.TryLockMany("a", "c")
+	require.NoError(t, err)
+	assert.True(t, locked)
+
+	require.NoError(t, mx.UnlockMany("a", "b", "c"))
+	assert.Equal(t, 0, mx.Size())
+}
+
+func TestLockManyInOppositeOrdersDoesNotDeadlock(t *testing.T) {
+	mx := newMemoryGroupMutex(t)
+
+	var wg sync.WaitGroup
+	for _, groupIDs := range [][]string{{"a", "b"}, {"b", "a"}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				err := mx.LockMany(ctx, groupIDs...)
+				cancel()
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				assert.NoError(t, mx.UnlockMany(groupIDs...))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 0, mx.Size())
+}
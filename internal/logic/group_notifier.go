@@ -0,0 +1,127 @@
+package logic
+
+import (
+	"context"
+	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"sync"
+	"time"
+)
+
+// notifyTimeout bounds a single delivery of notifications for a group
+const notifyTimeout = 30 * time.Second
+
+type groupNotifier struct {
+	delay    time.Duration
+	repo     adapters.Repository
+	notifier adapters.Notifier
+	logger   *logrus.Entry
+	// ctx is cancelled on shutdown, deliveries in flight give up then
+	ctx context.Context
+
+	mx sync.Mutex
+	// pending keeps devices that changed a group since the first change not notified yet
+	pending map[string]map[string]struct{}
+	timers  map[string]*time.Timer
+	stopped bool
+}
+
+func NewGroupNotifier(lc fx.Lifecycle, cfg *common.Config, repo adapters.Repository, notifier adapters.Notifier, logger *logrus.Entry) GroupNotifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &groupNotifier{
+		delay:    cfg.NotifyDelay,
+		repo:     repo,
+		notifier: notifier,
+		logger:   logger.WithField("job", "group_notifier"),
+		ctx:      ctx,
+		pending:  make(map[string]map[string]struct{}),
+		timers:   make(map[string]*time.Timer),
+	}
+
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			cancel()
+			n.stop()
+
+			return nil
+		},
+	})
+
+	return n
+}
+
+func (n *groupNotifier) Changed(groupID, deviceToken string) {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+
+	if n.stopped {
+		return
+	}
+
+	devices, ok := n.pending[groupID]
+	if !ok {
+		// the delay counts from the first change, so a busy group is still notified regularly
+		devices = make(map[string]struct{})
+		n.pending[groupID] = devices
+		n.timers[groupID] = time.AfterFunc(n.delay, func() {
+			n.flush(groupID)
+		})
+	}
+	devices[deviceToken] = struct{}{}
+}
+
+func (n *groupNotifier) flush(groupID string) {
+	n.mx.Lock()
+	changedBy := n.pending[groupID]
+	delete(n.pending, groupID)
+	delete(n.timers, groupID)
+	n.mx.Unlock()
+	// stopped meanwhile
+	if changedBy == nil {
+		return
+	}
+
+	logger := n.logger.WithField("group_id", groupID)
+
+	devices, err := n.repo.GetGroupDevices(groupID)
+	if err != nil {
+		logger.WithError(err).Error("failed to get group devices")
+
+		return
+	}
+
+	tokens := make([]string, 0, len(devices))
+	for _, device := range devices {
+		// a device that made all the changes has nothing to sync
+		if _, ok := changedBy[device.DeviceToken]; ok && len(changedBy) == 1 {
+			continue
+		}
+
+		tokens = append(tokens, device.DeviceToken)
+	}
+	if len(tokens) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(n.ctx, notifyTimeout)
+	defer cancel()
+
+	if err = n.notifier.Notify(ctx, groupID, tokens); err != nil {
+		logger.WithError(err).Error("failed to notify devices")
+	}
+}
+
+// stop drops changes not notified yet, their devices catch up on the next sync anyway.
+func (n *groupNotifier) stop() {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+
+	n.stopped = true
+	for _, timer := range n.timers {
+		timer.Stop()
+	}
+	n.timers = make(map[string]*time.Timer)
+	n.pending = make(map[string]map[string]struct{})
+}
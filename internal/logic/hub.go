@@ -0,0 +1,81 @@
+package logic
+
+import (
+	"sync"
+)
+
+type hub struct {
+	mx     sync.Mutex
+	groups map[string]map[*Subscription]struct{}
+}
+
+// Subscription receives a signal on C whenever other devices commit operations to the group. Signals coalesce:
+// a subscriber busy with the previous one gets a single signal for everything committed meanwhile, so a slow
+// subscriber never blocks publishers nor piles up pending events.
+type Subscription struct {
+	GroupID     string
+	DeviceToken string
+	C           <-chan struct{}
+
+	c chan struct{}
+}
+
+func NewHub() Hub {
+	return &hub{
+		groups: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+func (h *hub) Subscribe(groupID, deviceToken string) *Subscription {
+	c := make(chan struct{}, 1)
+	sub := &Subscription{
+		GroupID:     groupID,
+		DeviceToken: deviceToken,
+		C:           c,
+		c:           c,
+	}
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.groups[groupID] == nil {
+		h.groups[groupID] = make(map[*Subscription]struct{})
+	}
+	h.groups[groupID][sub] = struct{}{}
+
+	return sub
+}
+
+func (h *hub) Unsubscribe(sub *Subscription) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	delete(h.groups[sub.GroupID], sub)
+	if len(h.groups[sub.GroupID]) == 0 {
+		delete(h.groups, sub.GroupID)
+	}
+}
+
+func (h *hub) Publish(groupID, deviceToken string) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	for sub := range h.groups[groupID] {
+		if sub.DeviceToken == deviceToken {
+			continue
+		}
+
+		select {
+		case sub.c <- struct{}{}:
+		default:
+			// the subscriber has a pending signal already
+		}
+	}
+}
+
+func (h *hub) Size() int {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	return len(h.groups)
+}
@@ -1,21 +1,117 @@
 package logic
 
 import (
+	"context"
 	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
-	"sync"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"time"
 )
 
 type Service interface {
-	SyncData(deviceToken, userID string, server proto.SyncService_SyncDataServer) error
-	JoinGroup(deviceToken, userID, groupID string, mergeData bool, stream proto.SyncService_JoinGroupServer) error
-	LeaveGroup(deviceToken, userID string, copyData bool) error
+	// SyncData and JoinGroup return the device cursor, the id of the last operation the device has. When operations
+	// after the cursor were pruned SyncData sends the "sync-full-resync: true" header, the client then replaces all
+	// its data with the operations that follow, its uploads are stored and acknowledged as usual.
+	SyncData(deviceToken, userID string, server proto.SyncService_SyncDataServer) (int64, error)
+	// JoinGroup redeems the invite code and moves all devices of the user to the invite group
+	JoinGroup(deviceToken, userID, inviteCode string, mergeData bool, stream proto.SyncService_JoinGroupServer) (int64, error)
+	LeaveGroup(ctx context.Context, deviceToken, userID string, copyData bool) error
+	// CreateInvite creates an invite granting role in the current group of the device, only the owner can manage
+	// invites, zero ttl means the configured InviteTTL and empty role means editor
+	CreateInvite(deviceToken, userID string, ttl time.Duration, singleUse bool, role string) (*common.Invite, error)
+	GetInvites(deviceToken, userID string) ([]common.Invite, error)
+	RevokeInvite(deviceToken, userID, code string) error
+	// SetMemberRole lets the owner make another member of the group an editor or a viewer
+	SetMemberRole(ctx context.Context, deviceToken, userID, memberID, role string) error
+	// ListMembers returns members of the current group of the device with their devices
+	ListMembers(deviceToken, userID string) ([]common.MemberDevices, error)
+	// RemoveMember lets the owner move another member back to their personal group
+	RemoveMember(ctx context.Context, deviceToken, userID, memberID string) error
+	TransferOwnership(ctx context.Context, deviceToken, userID, memberID string) error
+	// Subscribe pushes operations other devices commit to the group of the device until the stream is closed or
+	// the device moves to another group
+	Subscribe(deviceToken, userID string, stream Subscriber) error
+}
+
+// Subscriber is the server stream of the Subscribe rpc
+type Subscriber interface {
+	Send(operations *proto.SimpleOperations) error
+	Context() context.Context
+}
+
+type Hub interface {
+	// Subscribe registers the device for signals about operations committed to the group
+	Subscribe(groupID, deviceToken string) *Subscription
+	Unsubscribe(sub *Subscription)
+	// Publish signals every subscriber of the group except the device that committed the operations
+	Publish(groupID, deviceToken string)
+	// Size returns the number of groups with subscribers
+	Size() int
 }
 
 type GroupMutex interface {
-	Lock(groupID string)
-	Unlock(groupID string)
+	// Lock blocks until the group is locked or ctx is done
+	Lock(ctx context.Context, groupID string) error
+	// TryLock locks the group only if it is free and reports whether it did
+	TryLock(groupID string) (bool, error)
+	Unlock(groupID string) error
+	// LockMany locks every distinct group in a canonical order, so concurrent callers never deadlock
+	LockMany(ctx context.Context, groupIDs ...string) error
+	// TryLockMany locks all groups or none of them
+	TryLockMany(groupIDs ...string) (bool, error)
+	UnlockMany(groupIDs ...string) error
+	// Size returns the number of groups currently tracked by the mutex
+	Size() int
 }
 
 type WorkerPool interface {
-	Add(server proto.SyncService_SyncDataServer, groupID string) *sync.WaitGroup
+	// Add schedules receiving of the stream uploads, the returned channel receives all of them at once
+	// uploads exceeding MaxUploadBatches or MaxUploadOperations fail with ErrUploadTooLarge
+	Add(server proto.SyncService_SyncDataServer) <-chan Upload
+	// Run runs fn on a worker and returns its error, so the pool bounds concurrent ingestion as well
+	Run(fn func() error) error
+}
+
+type Upload struct {
+	// Batches keeps operations grouped as the client sent them, so every batch is acknowledged separately
+	Batches [][]*proto.Operation
+	Err     error
+}
+
+// Clock is a hybrid logical clock, timestamps keep milliseconds in the high bits and a logical counter in the
+// low 16 bits, so they compare as plain integers
+type Clock interface {
+	// Now returns a timestamp after every timestamp the clock returned or observed
+	Now() int64
+	// Update observes a timestamp of a client and returns a timestamp after it, the timestamp must not be ahead of
+	// the wall clock more than ClockMaxDrift
+	Update(remote int64) (int64, error)
+	// Observe moves the clock past a timestamp stamped by a replica, which is trusted whatever its drift
+	Observe(stamped int64)
+}
+
+type GroupNotifier interface {
+	// Changed schedules a notification for the group devices, changes within NotifyDelay are notified together
+	// and a device isn't notified about its own changes
+	Changed(groupID, deviceToken string)
+}
+
+type Compactor interface {
+	// CompactAll compacts every group with enough operations after its snapshot
+	CompactAll(ctx context.Context) error
+	// Compact folds operations of the group added after its snapshot into a new snapshot
+	Compact(groupID string) error
+}
+
+type Retention interface {
+	// PruneAll prunes every group with operations covered by its snapshot
+	PruneAll(ctx context.Context) error
+	// Prune removes operations of the group synced by all its active devices and covered by its snapshot
+	Prune(groupID string) error
+}
+
+type GroupCleaner interface {
+	// CleanAll removes expired invites and every group abandoned longer than the grace period
+	CleanAll(ctx context.Context) error
+	// Clean removes data of the abandoned group unless somebody joined it meanwhile
+	Clean(groupID string) error
 }
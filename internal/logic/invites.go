@@ -0,0 +1,105 @@
+package logic
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// inviteCodeBytes gives 80 random bits, 16 characters once encoded
+const inviteCodeBytes = 10
+
+// inviteCodeEncoding uses only upper case letters and digits, so codes are easy to read out and type
+var inviteCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func (s *service) CreateInvite(deviceToken, userID string, ttl time.Duration, singleUse bool, role string) (*common.Invite, error) {
+	groupID, err := s.requireOwner(deviceToken, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == "" {
+		role = common.RoleEditor
+	}
+	// a second owner appears only by transferring the ownership
+	if role != common.RoleEditor && role != common.RoleViewer {
+		return nil, ErrInvalidRole
+	}
+
+	if ttl == 0 {
+		ttl = s.inviteTTL
+	}
+
+	code := make([]byte, inviteCodeBytes)
+	if _, err = rand.Read(code); err != nil {
+		return nil, errors.Wrap(err, "failed to generate invite code")
+	}
+
+	now := time.Now()
+	invite := &common.Invite{
+		Code:      inviteCodeEncoding.EncodeToString(code),
+		GroupId:   groupID,
+		CreatedBy: userID,
+		CreatedAt: now.UnixMicro(),
+		ExpiresAt: now.Add(ttl).UnixMicro(),
+		SingleUse: singleUse,
+		Role:      role,
+	}
+	if err = s.repo.CreateInvite(invite); err != nil {
+		return nil, errors.Wrap(err, "failed to create invite")
+	}
+
+	return invite, nil
+}
+
+func (s *service) GetInvites(deviceToken, userID string) ([]common.Invite, error) {
+	groupID, err := s.requireOwner(deviceToken, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	invites, err := s.repo.GetInvites(groupID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get invites")
+	}
+
+	return invites, nil
+}
+
+func (s *service) RevokeInvite(deviceToken, userID, code string) error {
+	groupID, err := s.requireOwner(deviceToken, userID)
+	if err != nil {
+		return err
+	}
+
+	invite, err := s.repo.GetInvite(code)
+	if err != nil {
+		return errors.Wrap(err, "failed to get invite")
+	}
+	// invites of other groups are reported as missing, so codes can't be probed
+	if invite == nil || invite.GroupId != groupID {
+		return ErrInviteNotFound
+	}
+
+	if err = s.repo.RemoveInvite(code); err != nil {
+		return errors.Wrap(err, "failed to remove invite")
+	}
+
+	return nil
+}
+
+// redeemableInvite returns the invite unless it is missing or expired.
+func redeemableInvite(repo adapters.Repository, code string) (*common.Invite, error) {
+	invite, err := repo.GetInvite(code)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get invite")
+	}
+	if invite == nil || invite.ExpiresAt < time.Now().UnixMicro() {
+		return nil, ErrInviteNotFound
+	}
+
+	return invite, nil
+}
@@ -0,0 +1,49 @@
+package logic
+
+import (
+	"context"
+	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"time"
+)
+
+// relistenDelay is the pause before listening again after the listener connection failed
+const relistenDelay = 5 * time.Second
+
+// ListenForCommits signals subscribers of this replica about operations committed by other replicas. Commits
+// made while the listener reconnects reach subscribers with the next signal of their group.
+func ListenForCommits(lc fx.Lifecycle, listener adapters.Listener, hub Hub, logger *logrus.Entry) {
+	if listener == nil {
+		return
+	}
+
+	logger = logger.WithField("job", "listener")
+	ctx, cancel := context.WithCancel(context.Background())
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				for {
+					err := listener.Listen(ctx, hub.Publish)
+					if ctx.Err() != nil {
+						return
+					}
+					logger.WithError(err).Error("listener failed")
+
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(relistenDelay):
+					}
+				}
+			}()
+
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+
+			return nil
+		},
+	})
+}
@@ -0,0 +1,274 @@
+package logic
+
+import (
+	"context"
+	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
+	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"time"
+)
+
+func (s *service) SetMemberRole(ctx context.Context, deviceToken, userID, memberID, role string) error {
+	if role != common.RoleEditor && role != common.RoleViewer {
+		return ErrInvalidRole
+	}
+
+	// a sync of the member checks the role under the same lock
+	groupID, err := s.lockOwnedGroup(ctx, deviceToken, userID)
+	if err != nil {
+		return err
+	}
+	defer s.unlock(groupID)
+
+	current, err := memberRole(s.repo, groupID, memberID)
+	if err != nil {
+		return err
+	}
+	// the owner changes only by transferring the ownership
+	if current == common.RoleOwner {
+		return ErrPermissionDenied
+	}
+
+	err = s.repo.SaveMember(&common.Member{
+		GroupId:  groupID,
+		UserId:   memberID,
+		Role:     role,
+		JoinedAt: time.Now().UnixMicro(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to save member")
+	}
+
+	return nil
+}
+
+func (s *service) ListMembers(deviceToken, userID string) ([]common.MemberDevices, error) {
+	groupID, err := s.repo.GetGroupID(deviceToken, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get group id")
+	}
+
+	if _, err = memberRole(s.repo, groupID, userID); err != nil {
+		return nil, err
+	}
+
+	records, err := s.repo.GetMembers(groupID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get members")
+	}
+
+	devices, err := s.repo.GetGroupDevices(groupID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get group devices")
+	}
+
+	members := make([]common.MemberDevices, 0, len(records)+1)
+	byUser := make(map[string]int, len(records)+1)
+	for _, record := range records {
+		byUser[record.UserId] = len(members)
+		members = append(members, common.MemberDevices{
+			UserId:   record.UserId,
+			Role:     record.Role,
+			JoinedAt: record.JoinedAt,
+			Devices:  make([]common.DeviceToken, 0),
+		})
+	}
+
+	for _, device := range devices {
+		i, ok := byUser[device.UserId]
+		if !ok {
+			// the owner of a personal group has no record
+			role, err := memberRole(s.repo, groupID, device.UserId)
+			if err != nil {
+				return nil, err
+			}
+
+			i = len(members)
+			byUser[device.UserId] = i
+			members = append(members, common.MemberDevices{UserId: device.UserId, Role: role})
+		}
+
+		members[i].Devices = append(members[i].Devices, device)
+	}
+
+	return members, nil
+}
+
+// RemoveMember moves all devices of the member back to their personal group with a copy of the group data, the
+// devices have it already, like LeaveGroup with copied data does.
+func (s *service) RemoveMember(ctx context.Context, deviceToken, userID, memberID string) error {
+	// the personal group of the member receives the copied operations
+	groupID, err := s.lockOwnedGroup(ctx, deviceToken, userID, memberID)
+	if err != nil {
+		return err
+	}
+	defer s.unlock(groupID, memberID)
+
+	// the owner leaves through LeaveGroup, and nobody can be moved out of their own personal group
+	if memberID == userID || memberID == groupID {
+		return ErrPermissionDenied
+	}
+
+	if _, err = memberRole(s.repo, groupID, memberID); err != nil {
+		return err
+	}
+
+	return s.repo.WithTx(func(repo adapters.Repository) error {
+		if err := copyToPersonalGroup(repo, groupID, memberID); err != nil {
+			return err
+		}
+
+		err := repo.UpdateGroupID(memberID, memberID)
+		if err != nil {
+			return errors.Wrap(err, "failed to update group id")
+		}
+
+		if err = repo.RemoveMember(groupID, memberID); err != nil {
+			return errors.Wrap(err, "failed to remove member")
+		}
+
+		return nil
+	})
+}
+
+// TransferOwnership makes the member the owner of the group and the current owner an editor.
+func (s *service) TransferOwnership(ctx context.Context, deviceToken, userID, memberID string) error {
+	groupID, err := s.lockOwnedGroup(ctx, deviceToken, userID)
+	if err != nil {
+		return err
+	}
+	defer s.unlock(groupID)
+
+	if memberID == userID {
+		return nil
+	}
+
+	if _, err = memberRole(s.repo, groupID, memberID); err != nil {
+		return err
+	}
+
+	return s.repo.WithTx(func(repo adapters.Repository) error {
+		now := time.Now().UnixMicro()
+		err := repo.SaveMember(&common.Member{GroupId: groupID, UserId: memberID, Role: common.RoleOwner, JoinedAt: now})
+		if err != nil {
+			return errors.Wrap(err, "failed to save new owner")
+		}
+
+		err = repo.SaveMember(&common.Member{GroupId: groupID, UserId: userID, Role: common.RoleEditor, JoinedAt: now})
+		if err != nil {
+			return errors.Wrap(err, "failed to save previous owner")
+		}
+
+		return nil
+	})
+}
+
+// lockOwnedGroup locks the current group of the device together with the other groups and returns it if the user
+// owns it. The ownership is checked under the lock, so it holds until the groups are unlocked.
+func (s *service) lockOwnedGroup(ctx context.Context, deviceToken, userID string, others ...string) (string, error) {
+	groupID, err := s.repo.GetGroupID(deviceToken, userID)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get group id")
+	}
+
+	groupIDs := append([]string{groupID}, others...)
+	if err = s.lock(ctx, groupIDs...); err != nil {
+		return "", err
+	}
+
+	current, err := s.requireOwner(deviceToken, userID)
+	if err == nil && current != groupID {
+		err = ErrGroupChanged
+	}
+	if err != nil {
+		s.unlock(groupIDs...)
+
+		return "", err
+	}
+
+	return groupID, nil
+}
+
+// requireOwner returns the current group of the device if the user owns it.
+func (s *service) requireOwner(deviceToken, userID string) (string, error) {
+	groupID, err := s.repo.GetGroupID(deviceToken, userID)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get group id")
+	}
+
+	role, err := memberRole(s.repo, groupID, userID)
+	if err != nil {
+		return "", err
+	}
+	if role != common.RoleOwner {
+		return "", ErrPermissionDenied
+	}
+
+	return groupID, nil
+}
+
+// memberRole returns the role of the user in the group, users own their personal group unless they gave it away.
+func memberRole(repo adapters.Repository, groupID, userID string) (string, error) {
+	member, err := repo.GetMember(groupID, userID)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get member")
+	}
+	if member != nil {
+		return member.Role, nil
+	}
+	if groupID == userID {
+		return common.RoleOwner, nil
+	}
+
+	return "", ErrMemberNotFound
+}
+
+// ownerCanLeave fails if the user owns the group and other users are still in it, they would be left without an owner.
+func ownerCanLeave(repo adapters.Repository, groupID, userID string) error {
+	role, err := memberRole(repo, groupID, userID)
+	if errors.Is(err, ErrMemberNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if role != common.RoleOwner {
+		return nil
+	}
+
+	others, err := hasOtherUsers(repo, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if others {
+		return ErrOwnerLeaving
+	}
+
+	return nil
+}
+
+// hasOtherUsers reports whether devices of other users than the given one are in the group.
+func hasOtherUsers(repo adapters.Repository, groupID, userID string) (bool, error) {
+	devices, err := repo.GetGroupDevices(groupID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get group devices")
+	}
+	for _, device := range devices {
+		if device.UserId != userID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func hasOperations(batches [][]*proto.Operation) bool {
+	for _, batch := range batches {
+		if len(batch) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package logic
+
+import (
+	"encoding/json"
+	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
+	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+)
+
+const operationUpdate = "OPERATION_UPDATE"
+
+// structuredArgs are the Args of a structured operation: an update without Sql that sets one field of an entity.
+// The field_write key marks it, operations without it are replayed as they are whatever their Sql is.
+type structuredArgs struct {
+	FieldWrite *fieldWrite `json:"field_write"`
+}
+
+// fieldWrite is applied by clients only if it is newer than the write they have for the field, compared like newer
+// does, so concurrent edits converge whatever order they arrive in.
+type fieldWrite struct {
+	Entity   string `json:"entity"`
+	EntityID string `json:"entity_id"`
+	Field    string `json:"field"`
+	// Value is kept as sent, ties of Timestamp are broken by comparing its bytes
+	Value     json.RawMessage `json:"value"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+// parseFieldWrite returns nil for operations that are not structured.
+func parseFieldWrite(operationType, sql, args string) (*fieldWrite, error) {
+	if sql != "" {
+		return nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(args), &fields); err != nil {
+		return nil, nil
+	}
+	if _, ok := fields["field_write"]; !ok {
+		return nil, nil
+	}
+
+	if operationType != operationUpdate {
+		return nil, errors.Wrap(ErrInvalidOperation, "structured operation is not an update")
+	}
+
+	structured := &structuredArgs{}
+	if err := json.Unmarshal([]byte(args), structured); err != nil {
+		return nil, errors.Wrap(ErrInvalidOperation, err.Error())
+	}
+	write := structured.FieldWrite
+	if write == nil || write.Entity == "" || write.EntityID == "" || write.Field == "" || len(write.Value) == 0 {
+		return nil, errors.Wrap(ErrInvalidOperation, "structured operation misses entity, entity_id, field or value")
+	}
+
+	return write, nil
+}
+
+// newer reports whether the write wins over the latest accepted write of the field.
+func newer(write *fieldWrite, latest *common.FieldWrite) bool {
+	return write.Timestamp > latest.Timestamp ||
+		(write.Timestamp == latest.Timestamp && string(write.Value) >= latest.Value)
+}
+
+func (w *fieldWrite) model(groupID string) *common.FieldWrite {
+	return &common.FieldWrite{
+		GroupId:    groupID,
+		EntityName: w.Entity,
+		EntityId:   w.EntityID,
+		Field:      w.Field,
+		Timestamp:  w.Timestamp,
+		Value:      string(w.Value),
+	}
+}
+
+// resolve drops structured writes older than the latest accepted write of their field and records the others,
+// deletes forget the fields of their entities. Dropped writes never reach the log and are acknowledged with zero
+// sequence, unless an earlier upload of the same write was stored, a retry gets the sequence of the stored write.
+// An equal write is kept, so a retried upload is deduplicated and acknowledged as usual.
+func resolve(repo adapters.Repository, groupID string, operations []*proto.Operation) ([]*proto.Operation, []*proto.OperationAck, error) {
+	kept := make([]*proto.Operation, 0, len(operations))
+	acks := make([]*proto.OperationAck, 0)
+	for _, op := range operations {
+		if op.Type == proto.OperationType_OPERATION_DELETE {
+			for _, entity := range op.RelatedEntities {
+				if err := repo.RemoveFieldWrites(groupID, entity.Name, entity.Id); err != nil {
+					return nil, nil, errors.Wrap(err, "failed to remove field writes")
+				}
+			}
+		}
+
+		write, err := parseFieldWrite(op.Type.String(), op.Sql, op.Args)
+		if err != nil {
+			return nil, nil, err
+		}
+		if write == nil {
+			kept = append(kept, op)
+
+			continue
+		}
+
+		latest, err := repo.GetFieldWrite(groupID, write.Entity, write.EntityID, write.Field)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to get field write")
+		}
+		if latest != nil && !newer(write, latest) {
+			if op.Id != "" {
+				sequence, err := repo.GetOperationID(groupID, op.Id)
+				if err != nil {
+					return nil, nil, errors.Wrap(err, "failed to get stored operation")
+				}
+				acks = append(acks, &proto.OperationAck{Id: op.Id, Sequence: sequence})
+			}
+
+			continue
+		}
+
+		if err = repo.SaveFieldWrite(write.model(groupID)); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to save field write")
+		}
+
+		// conflict cleanup and squashing work on related entities
+		op.RelatedEntities = []*proto.RelatedEntity{{Id: write.EntityID, Name: write.Entity}}
+		kept = append(kept, op)
+	}
+
+	return kept, acks, nil
+}
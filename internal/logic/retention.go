@@ -0,0 +1,108 @@
+package logic
+
+import (
+	"context"
+	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"time"
+)
+
+type retention struct {
+	mx           GroupMutex
+	repo         adapters.Repository
+	staleHorizon time.Duration
+	logger       *logrus.Entry
+}
+
+func NewRetention(cfg *common.Config, mx GroupMutex, repo adapters.Repository, logger *logrus.Entry) Retention {
+	return &retention{
+		mx:           mx,
+		repo:         repo,
+		staleHorizon: cfg.StaleDeviceHorizon,
+		logger:       logger,
+	}
+}
+
+// ScheduleRetention prunes synced operations every RetentionInterval.
+func ScheduleRetention(lc fx.Lifecycle, cfg *common.Config, r Retention, logger *logrus.Entry) {
+	schedule(lc, cfg.RetentionInterval, r.PruneAll, logger.WithField("job", "retention"))
+}
+
+func (r *retention) PruneAll(ctx context.Context) error {
+	groups, err := r.repo.GetGroupsToPrune()
+	if err != nil {
+		return errors.Wrap(err, "failed to get groups to prune")
+	}
+
+	for _, groupID := range groups {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err = r.Prune(groupID); err != nil {
+			r.logger.WithError(err).WithField("group_id", groupID).Error("failed to prune group")
+		}
+	}
+
+	return nil
+}
+
+func (r *retention) Prune(groupID string) error {
+	// a busy group is pruned on the next run instead of delaying syncs
+	locked, err := r.mx.TryLock(groupID)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock group")
+	}
+	if !locked {
+		return nil
+	}
+	defer func() {
+		if err := r.mx.Unlock(groupID); err != nil {
+			r.logger.WithError(err).WithField("group_id", groupID).Error("failed to unlock group")
+		}
+	}()
+
+	// new devices bootstrap from the snapshot, so it bounds what can be removed
+	snapshot, err := r.repo.GetSnapshot(groupID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get snapshot")
+	}
+	if snapshot == nil {
+		return nil
+	}
+
+	devices, err := r.repo.GetGroupDevices(groupID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get group devices")
+	}
+
+	upTo := snapshot.Watermark
+	for _, device := range devices {
+		if !r.stale(device) && device.LastOperationId < upTo {
+			upTo = device.LastOperationId
+		}
+	}
+	if upTo <= snapshot.PrunedUpTo {
+		return nil
+	}
+
+	if err = r.repo.PruneData(groupID, upTo); err != nil {
+		return errors.Wrap(err, "failed to prune data")
+	}
+
+	r.logger.WithFields(logrus.Fields{"group_id": groupID, "pruned_up_to": upTo}).Info("pruned synced operations")
+
+	return nil
+}
+
+// stale reports whether the device was inactive longer than the horizon, such devices don't hold back pruning.
+func (r *retention) stale(device common.DeviceToken) bool {
+	if r.staleHorizon == 0 {
+		return false
+	}
+
+	return time.Since(time.UnixMicro(device.LastSync)) > r.staleHorizon
+}
@@ -0,0 +1,43 @@
+package logic
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"time"
+)
+
+// schedule runs job every interval while the application is running, zero interval disables the job.
+func schedule(lc fx.Lifecycle, interval time.Duration, job func(ctx context.Context) error, logger *logrus.Entry) {
+	if interval == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+						if err := job(ctx); err != nil {
+							logger.WithError(err).Error("scheduled job failed")
+						}
+					}
+				}
+			}()
+
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+
+			return nil
+		},
+	})
+}
@@ -1,146 +1,398 @@
 package logic
 
 import (
+	"context"
 	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
 	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/Gregmus2/sync-service/internal/common"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strconv"
+	"time"
 )
 
 var (
-	ErrGroupNotFound = errors.New("group not found")
-	ErrNotInGroup    = errors.New("not in group")
+	ErrGroupNotFound    = errors.New("group not found")
+	ErrNotInGroup       = errors.New("not in group")
+	ErrAlreadyInGroup   = errors.New("already in group")
+	ErrLockTimeout      = errors.New("group lock wait timed out")
+	ErrLockAborted      = errors.New("group lock wait aborted")
+	ErrUploadFailed     = errors.New("upload failed")
+	ErrUploadTooLarge   = errors.New("upload too large")
+	ErrInviteNotFound   = errors.New("invite not found")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrReadOnly         = errors.New("read-only member")
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrMemberNotFound   = errors.New("member not found")
+	ErrOwnerLeaving     = errors.New("owner can't leave a group with members")
+	ErrGroupChanged     = errors.New("group changed while waiting for the lock")
+	ErrInvalidOperation = errors.New("invalid structured operation")
+	ErrInvalidClock     = errors.New("invalid hybrid logical clock")
 )
 
-const chunkSize = 1000
+const (
+	chunkSize       = 1000
+	operationDelete = "OPERATION_DELETE"
+	// fullResyncHeader tells the client to replace its data with the group state that follows,
+	// its pending operations are still uploaded and acknowledged
+	fullResyncHeader = "sync-full-resync"
+	// maxUploadBatchesHeader and maxUploadOperationsHeader tell the client the bounds of a single upload, a larger one
+	// fails with ErrUploadTooLarge, so the client has to split its pending operations across several syncs
+	maxUploadBatchesHeader    = "sync-max-upload-batches"
+	maxUploadOperationsHeader = "sync-max-upload-operations"
+	// deviceLockPrefix keeps device locks apart from group locks in the group mutex
+	deviceLockPrefix = "device:"
+	// clockHeader carries the hybrid logical clock of the server in trailers, clients merge it into their clock to
+	// stamp later operations after everything they have seen
+	clockHeader = "sync-hlc"
+)
 
 type service struct {
 	mx GroupMutex
 
-	repo adapters.Repository
-	wp   WorkerPool
+	lockTimeout time.Duration
+	gracePeriod time.Duration
+	inviteTTL   time.Duration
+	// maxUploadBatches and maxUploadOperations are only announced, the worker pool enforces them
+	maxUploadBatches    int
+	maxUploadOperations int
+	// legacyGroupJoin accepts group ids as invite codes
+	legacyGroupJoin bool
+
+	repo     adapters.Repository
+	wp       WorkerPool
+	hub      Hub
+	notifier GroupNotifier
+	clock    Clock
+	logger   *logrus.Entry
 }
 
-func NewService(mx GroupMutex, repo adapters.Repository, wp WorkerPool) Service {
+func NewService(cfg *common.Config, mx GroupMutex, repo adapters.Repository, wp WorkerPool, hub Hub, notifier GroupNotifier, clock Clock, logger *logrus.Entry) Service {
 	return &service{
-		mx:   mx,
-		repo: repo,
-		wp:   wp,
+		mx:                  mx,
+		lockTimeout:         cfg.LockTimeout,
+		gracePeriod:         cfg.GroupGracePeriod,
+		inviteTTL:           cfg.InviteTTL,
+		maxUploadBatches:    cfg.MaxUploadBatches,
+		maxUploadOperations: cfg.MaxUploadOperations,
+		legacyGroupJoin:     cfg.LegacyGroupJoin,
+		repo:                repo,
+		wp:                  wp,
+		hub:                 hub,
+		notifier:            notifier,
+		clock:               clock,
+		logger:              logger,
 	}
 }
 
-func (s *service) SyncData(deviceToken, userID string, stream proto.SyncService_SyncDataServer) error {
+func (s *service) SyncData(deviceToken, userID string, stream proto.SyncService_SyncDataServer) (int64, error) {
 	groupID, err := s.repo.GetGroupID(deviceToken, userID)
 	if err != nil {
-		return errors.Wrap(err, "failed to get group id")
+		return 0, errors.Wrap(err, "failed to get group id")
+	}
+
+	// a push to a subscription of the device must not send the same operations meanwhile
+	if err := s.lockDevice(stream.Context(), deviceToken); err != nil {
+		return 0, err
 	}
+	defer s.unlockDevice(deviceToken)
 
-	s.mx.Lock(groupID)
-	defer s.mx.Unlock(groupID)
+	if err := s.lock(stream.Context(), groupID); err != nil {
+		return 0, err
+	}
+	defer s.unlock(groupID)
 
-	wg := s.wp.Add(stream, groupID)
+	// other devices of the user may move it to another group until the group is locked, the upload and the cursor
+	// would go to the old group then
+	if err = s.sameGroup(deviceToken, userID, groupID); err != nil {
+		return 0, err
+	}
 
-	data, err := s.repo.GetData(deviceToken, groupID)
+	role, err := memberRole(s.repo, groupID, userID)
 	if err != nil {
-		return errors.Wrap(err, "failed to get data")
+		return 0, err
 	}
 
-	for i := 0; i < len(data); i += chunkSize {
-		end := i + chunkSize
-		if end > len(data) {
-			end = len(data)
-		}
+	result := s.wp.Add(stream)
 
-		err = stream.Send(&proto.SimpleOperations{Operations: data[i:end]})
-		if err != nil {
-			return errors.Wrap(err, "failed to send data")
-		}
+	cursor, err := s.repo.GetCursor(deviceToken)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get device cursor")
 	}
 
-	wg.Wait()
+	snapshot, err := s.repo.GetSnapshot(groupID)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get snapshot")
+	}
 
-	if err := s.repo.CleanConflicted(deviceToken, groupID); err != nil {
-		return errors.Wrap(err, "failed to clean conflicts")
+	header := metadata.Pairs(
+		maxUploadBatchesHeader, strconv.Itoa(s.maxUploadBatches),
+		maxUploadOperationsHeader, strconv.Itoa(s.maxUploadOperations),
+	)
+
+	var data []*proto.SimpleOperation
+	switch {
+	case cursor == 0:
+		// a new device starts from the group snapshot instead of the whole history
+		data, err = s.bootstrap(groupID, snapshot)
+	case isPruned(snapshot, cursor):
+		// operations after the cursor are gone, a delta would silently miss them
+		header.Set(fullResyncHeader, "true")
+		data, err = s.bootstrap(groupID, snapshot)
+	default:
+		data, err = s.unsynced(deviceToken, groupID, cursor)
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get data")
 	}
 
-	if err := s.repo.UpdateDeviceTokenTime(deviceToken, userID, groupID); err != nil {
-		return errors.Wrap(err, "failed to update device token time")
+	if err = stream.SendHeader(header); err != nil {
+		return 0, errors.Wrap(err, "failed to send header")
 	}
 
-	return nil
+	if err = sendOperations(stream, data); err != nil {
+		return 0, err
+	}
+
+	// the device cursor must not move past uploads that were lost
+	upload := <-result
+	if upload.Err != nil {
+		return 0, upload.Err
+	}
+	if role == common.RoleViewer && hasOperations(upload.Batches) {
+		return 0, ErrReadOnly
+	}
+
+	// uploads, conflict cleanup and the device cursor are committed together or not at all, on a worker, so the
+	// pool bounds concurrent writes as well
+	acks := make([][]*proto.OperationAck, 0, len(upload.Batches))
+	err = s.wp.Run(func() error {
+		return s.repo.WithTx(func(repo adapters.Repository) error {
+			// operations of the group may be stamped by another replica with a clock behind this one
+			latest, err := repo.GetMaxHLC(groupID)
+			if err != nil {
+				return errors.Wrap(err, "failed to get group clock")
+			}
+			s.clock.Observe(latest)
+
+			for _, batch := range upload.Batches {
+				batch, supersededAcks, err := resolve(repo, groupID, batch)
+				if err != nil {
+					return err
+				}
+
+				stamps, err := s.stamp(batch)
+				if err != nil {
+					return err
+				}
+
+				batchAcks, err := repo.InsertData(deviceToken, groupID, batch, stamps)
+				if err != nil {
+					s.logger.WithError(err).Error("failed to insert data")
+
+					return errors.Wrap(ErrUploadFailed, "failed to insert data")
+				}
+
+				acks = append(acks, append(batchAcks, supersededAcks...))
+			}
+
+			if err := repo.CleanConflicted(deviceToken, groupID); err != nil {
+				return errors.Wrap(err, "failed to clean conflicts")
+			}
+
+			cursor, err = repo.UpdateDeviceCursor(deviceToken, userID, groupID)
+			if err != nil {
+				return errors.Wrap(err, "failed to update device cursor")
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if hasOperations(upload.Batches) {
+		s.committed(groupID, deviceToken)
+	}
+	s.sendClock(stream)
+
+	// operations are persisted only once the transaction is committed
+	for _, batchAcks := range acks {
+		err = stream.Send(&proto.SimpleOperations{Acks: batchAcks})
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to send acknowledgements")
+		}
+	}
+
+	return cursor, nil
 }
 
-func (s *service) JoinGroup(deviceToken, userID, groupID string, mergeData bool, stream proto.SyncService_JoinGroupServer) error {
+func (s *service) JoinGroup(deviceToken, userID, inviteCode string, mergeData bool, stream proto.SyncService_JoinGroupServer) (int64, error) {
+	invite, err := s.joinInvite(inviteCode)
+	if err != nil {
+		return 0, err
+	}
+	groupID := invite.GroupId
+
 	exists, err := s.repo.IsGroupExists(groupID)
 	if err != nil {
-		return errors.Wrap(err, "failed to check if group exists")
+		return 0, errors.Wrap(err, "failed to check if group exists")
 	}
 	if !exists {
-		return ErrGroupNotFound
+		return 0, ErrGroupNotFound
 	}
 
 	currentGroupID, err := s.repo.GetGroupID(deviceToken, userID)
 	if err != nil {
-		return errors.Wrap(err, "failed to get group id")
+		return 0, errors.Wrap(err, "failed to get group id")
+	}
+	// rejoining the current group would remove its data below
+	if currentGroupID == groupID {
+		return 0, ErrAlreadyInGroup
 	}
 
-	s.mx.Lock(groupID)
-	s.mx.Lock(currentGroupID)
-	defer s.mx.Unlock(groupID)
-	defer s.mx.Unlock(currentGroupID)
+	if err := s.lockDevice(stream.Context(), deviceToken); err != nil {
+		return 0, err
+	}
+	defer s.unlockDevice(deviceToken)
+
+	if err := s.lock(stream.Context(), groupID, currentGroupID); err != nil {
+		return 0, err
+	}
+	defer s.unlock(groupID, currentGroupID)
+
+	// members of the current group and its owner may change until it is locked
+	if err = s.sameGroup(deviceToken, userID, currentGroupID); err != nil {
+		return 0, err
+	}
+	if err = ownerCanLeave(s.repo, currentGroupID, userID); err != nil {
+		return 0, err
+	}
+	shared, err := hasOtherUsers(s.repo, currentGroupID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	// the invite may have been revoked or redeemed while waiting for the lock, which serializes redemptions
+	if _, err = s.joinInvite(inviteCode); err != nil {
+		return 0, err
+	}
+	if mergeData && invite.Role == common.RoleViewer {
+		return 0, ErrReadOnly
+	}
+
+	snapshot, err := s.repo.GetSnapshot(groupID)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get snapshot")
+	}
 
 	// retrieve all operations from the group first, because later they will be mixed with the user's operations
-	operations, err := s.repo.GetAllData(groupID)
+	operations, err := s.bootstrap(groupID, snapshot)
 	if err != nil {
-		return errors.Wrap(err, "failed to get all data")
+		return 0, errors.Wrap(err, "failed to get all data")
 	}
 
 	if mergeData {
-		unsyncedOperations, err := s.repo.GetData(deviceToken, currentGroupID)
+		cursor, err := s.repo.GetCursor(deviceToken)
 		if err != nil {
-			return errors.Wrap(err, "failed to get data")
+			return 0, errors.Wrap(err, "failed to get device cursor")
+		}
+
+		unsyncedOperations, err := s.unsynced(deviceToken, currentGroupID, cursor)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to get data")
 		}
 
 		operations = append(operations, unsyncedOperations...)
 	}
 
-	for i := 0; i < len(operations); i += chunkSize {
-		end := i + chunkSize
-		if end > len(operations) {
-			end = len(operations)
+	if err = sendOperations(stream, operations); err != nil {
+		return 0, err
+	}
+
+	var cursor int64
+	err = s.repo.WithTx(func(repo adapters.Repository) error {
+		err := repo.UpdateGroupID(userID, groupID)
+		if err != nil {
+			return errors.Wrap(err, "failed to update group id")
 		}
 
-		err = stream.Send(&proto.SimpleOperations{Operations: operations[i:end]})
+		// joining an abandoned group cancels its deletion
+		err = repo.UnmarkGroupAbandoned(groupID)
 		if err != nil {
-			return errors.Wrap(err, "failed to send data")
+			return errors.Wrap(err, "failed to unmark group abandoned")
 		}
-	}
 
-	err = s.repo.UpdateGroupID(userID, groupID)
-	if err != nil {
-		return errors.Wrap(err, "failed to update group id")
-	}
+		if invite.SingleUse {
+			err = repo.RemoveInvite(inviteCode)
+			if err != nil {
+				return errors.Wrap(err, "failed to redeem invite")
+			}
+		}
 
-	err = s.repo.UpdateDeviceTokenTime(deviceToken, userID, groupID)
-	if err != nil {
-		return errors.Wrap(err, "failed to update device token time")
-	}
+		err = repo.RemoveMember(currentGroupID, userID)
+		if err != nil {
+			return errors.Wrap(err, "failed to remove member")
+		}
 
-	if mergeData {
-		err = s.repo.MigrateData(currentGroupID, groupID)
+		err = repo.SaveMember(&common.Member{
+			GroupId:  groupID,
+			UserId:   userID,
+			Role:     invite.Role,
+			JoinedAt: time.Now().UnixMicro(),
+		})
 		if err != nil {
-			return errors.Wrap(err, "failed to migrate data")
+			return errors.Wrap(err, "failed to save member")
+		}
+
+		switch {
+		// a group other users still sync keeps its data, it goes away with its last device
+		case shared || currentGroupID != userID:
+			if mergeData {
+				if _, err = repo.CopyOperations(currentGroupID, groupID); err != nil {
+					return errors.Wrap(err, "failed to copy operations")
+				}
+			}
+
+			if err = abandonIfEmpty(repo, currentGroupID, s.gracePeriod); err != nil {
+				return errors.Wrap(err, "failed to clean up group")
+			}
+		case mergeData:
+			err = repo.MigrateData(currentGroupID, groupID)
+			if err != nil {
+				return errors.Wrap(err, "failed to migrate data")
+			}
+		default:
+			err = repo.RemoveData(currentGroupID)
+			if err != nil {
+				return errors.Wrap(err, "failed to remove data")
+			}
 		}
-	} else {
-		err = s.repo.RemoveData(currentGroupID)
+
+		// after the migration, so the device doesn't download the merged operations it just received
+		cursor, err = repo.UpdateDeviceCursor(deviceToken, userID, groupID)
 		if err != nil {
-			return errors.Wrap(err, "failed to remove data")
+			return errors.Wrap(err, "failed to update device cursor")
 		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	if mergeData {
+		s.committed(groupID, deviceToken)
+	}
+	s.sendClock(stream)
+
+	return cursor, nil
 }
 
-func (s *service) LeaveGroup(deviceToken, userID string, copyData bool) error {
+func (s *service) LeaveGroup(ctx context.Context, deviceToken, userID string, copyData bool) error {
 	groupID, err := s.repo.GetGroupID(deviceToken, userID)
 	if err != nil {
 		return errors.Wrap(err, "failed to get group id")
@@ -149,22 +401,232 @@ func (s *service) LeaveGroup(deviceToken, userID string, copyData bool) error {
 		return ErrNotInGroup
 	}
 
-	s.mx.Lock(groupID)
-	defer s.mx.Unlock(groupID)
+	// the personal group receives the copied operations
+	if err := s.lock(ctx, groupID, userID); err != nil {
+		return err
+	}
+	defer s.unlock(groupID, userID)
+
+	if err = s.sameGroup(deviceToken, userID, groupID); err != nil {
+		return err
+	}
+	if err = ownerCanLeave(s.repo, groupID, userID); err != nil {
+		return err
+	}
+
+	return s.repo.WithTx(func(repo adapters.Repository) error {
+		if copyData {
+			if err := copyToPersonalGroup(repo, groupID, userID); err != nil {
+				return err
+			}
+		}
 
-	if copyData {
-		err := s.repo.CopyOperations(groupID, userID)
+		err := repo.UpdateGroupID(userID, userID)
 		if err != nil {
-			return errors.Wrap(err, "failed to copy operations")
+			return errors.Wrap(err, "failed to update group id")
+		}
+
+		if err = repo.RemoveMember(groupID, userID); err != nil {
+			return errors.Wrap(err, "failed to remove member")
 		}
+
+		if err = abandonIfEmpty(repo, groupID, s.gracePeriod); err != nil {
+			return errors.Wrap(err, "failed to clean up group")
+		}
+
+		return nil
+	})
+}
+
+// sameGroup fails if the device moved to another group than the locked one.
+func (s *service) sameGroup(deviceToken, userID, groupID string) error {
+	current, err := s.repo.GetGroupID(deviceToken, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get group id")
+	}
+	if current != groupID {
+		return ErrGroupChanged
+	}
+
+	return nil
+}
+
+// joinInvite returns the invite with the code. While legacyGroupJoin is on, clients without invites send a group id
+// instead, which joins the group like a reusable editor invite, JoinGroup checks that the group exists.
+func (s *service) joinInvite(code string) (*common.Invite, error) {
+	invite, err := redeemableInvite(s.repo, code)
+	if !errors.Is(err, ErrInviteNotFound) || !s.legacyGroupJoin {
+		return invite, err
+	}
+
+	return &common.Invite{GroupId: code, Role: common.RoleEditor}, nil
+}
+
+// copyToPersonalGroup copies operations of the group to the personal group of the user. The copies get new ids,
+// devices of the user must not download the operations they have again.
+func copyToPersonalGroup(repo adapters.Repository, groupID, userID string) error {
+	devices, err := repo.GetGroupDevices(groupID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get group devices")
+	}
+
+	copied, err := repo.CopyOperations(groupID, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed to copy operations")
+	}
+
+	for _, device := range devices {
+		if device.UserId != userID {
+			continue
+		}
+
+		err = repo.AdvanceDeviceCursor(device.DeviceToken, copiedCursor(copied, device.LastOperationId))
+		if err != nil {
+			return errors.Wrap(err, "failed to advance device cursor")
+		}
+	}
+
+	return nil
+}
+
+// copiedCursor returns the cursor past the copies of operations up to the cursor, zero if none of them was copied.
+func copiedCursor(copied []common.CopiedOperation, cursor int64) int64 {
+	var moved int64
+	for _, op := range copied {
+		if op.FromID <= cursor && op.ToID > moved {
+			moved = op.ToID
+		}
+	}
+
+	return moved
+}
+
+// stamp returns a timestamp of the server clock for every operation. A structured write carries the clock of its
+// device when it was made, it's merged into the server clock first.
+func (s *service) stamp(operations []*proto.Operation) ([]int64, error) {
+	stamps := make([]int64, 0, len(operations))
+	for _, op := range operations {
+		var observed int64
+		write, err := parseFieldWrite(op.Type.String(), op.Sql, op.Args)
+		if err != nil {
+			return nil, err
+		}
+		if write != nil {
+			observed = write.Timestamp
+		}
+
+		stamp, err := s.clock.Update(observed)
+		if err != nil {
+			return nil, err
+		}
+		stamps = append(stamps, stamp)
 	}
 
-	// todo check if group has any users left and remove group and data if not
+	return stamps, nil
+}
+
+// sendClock sets the trailer with the server clock, so the client stamps its next operations after the ones it got.
+func (s *service) sendClock(stream grpc.ServerStream) {
+	stream.SetTrailer(metadata.Pairs(clockHeader, strconv.FormatInt(s.clock.Now(), 10)))
+}
+
+// committed tells subscribed and sleeping devices of the group about operations committed by the device.
+func (s *service) committed(groupID, deviceToken string) {
+	s.hub.Publish(groupID, deviceToken)
+	s.notifier.Changed(groupID, deviceToken)
+}
+
+// bootstrap returns the group snapshot, nil if the group has none, followed by the operations added after it.
+func (s *service) bootstrap(groupID string, snapshot *common.Snapshot) ([]*proto.SimpleOperation, error) {
+	var watermark int64
+	operations := make([]common.LoggedOperation, 0)
+	if snapshot != nil {
+		watermark = snapshot.Watermark
+		operations = append(operations, snapshot.Operations...)
+	}
+
+	tail, err := s.repo.GetLog(groupID, watermark)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get operations after snapshot")
+	}
+
+	return simpleOperations(squash(append(operations, tail...), 0)), nil
+}
+
+// isPruned reports whether operations after the cursor were removed from the log of the group snapshot.
+func isPruned(snapshot *common.Snapshot, cursor int64) bool {
+	return snapshot != nil && cursor < snapshot.PrunedUpTo
+}
 
-	err = s.repo.UpdateGroupID(userID, userID)
+// unsynced returns operations of other devices after the device cursor squashed to their net effect.
+func (s *service) unsynced(deviceToken, groupID string, cursor int64) ([]*proto.SimpleOperation, error) {
+	operations, err := s.repo.GetData(deviceToken, groupID)
 	if err != nil {
-		return errors.Wrap(err, "failed to update group id")
+		return nil, err
+	}
+
+	return simpleOperations(squash(operations, cursor)), nil
+}
+
+// sendOperations sends operations in chunks of chunkSize.
+func sendOperations(stream Subscriber, operations []*proto.SimpleOperation) error {
+	for i := 0; i < len(operations); i += chunkSize {
+		end := i + chunkSize
+		if end > len(operations) {
+			end = len(operations)
+		}
+
+		err := stream.Send(&proto.SimpleOperations{Operations: operations[i:end]})
+		if err != nil {
+			return errors.Wrap(err, "failed to send data")
+		}
 	}
 
 	return nil
 }
+
+// lock waits for the groups at most lockTimeout, with zero timeout a busy group is rejected right away.
+func (s *service) lock(ctx context.Context, groupIDs ...string) error {
+	if s.lockTimeout == 0 {
+		locked, err := s.mx.TryLockMany(groupIDs...)
+		if err != nil {
+			return errors.Wrap(err, "failed to lock group")
+		}
+		if !locked {
+			return ErrLockAborted
+		}
+
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.lockTimeout)
+	defer cancel()
+
+	err := s.mx.LockMany(ctx, groupIDs...)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return ErrLockTimeout
+	case errors.Is(ctx.Err(), context.Canceled):
+		return ErrLockAborted
+	default:
+		return errors.Wrap(err, "failed to lock group")
+	}
+}
+
+func (s *service) unlock(groupIDs ...string) {
+	if err := s.mx.UnlockMany(groupIDs...); err != nil {
+		s.logger.WithError(err).WithField("group_ids", groupIDs).Error("failed to unlock groups")
+	}
+}
+
+// lockDevice serializes deliveries to the device. A device is always locked before its group and never while a group
+// is held, so device and group locks can't deadlock.
+func (s *service) lockDevice(ctx context.Context, deviceToken string) error {
+	return s.lock(ctx, deviceLockPrefix+deviceToken)
+}
+
+func (s *service) unlockDevice(deviceToken string) {
+	s.unlock(deviceLockPrefix + deviceToken)
+}
@@ -0,0 +1,547 @@
+package logic
+
+import (
+	"context"
+	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
+	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStream is a SyncData and JoinGroup stream that uploads the given batches
+type testStream struct {
+	grpc.ServerStream
+
+	ctx     context.Context
+	mx      sync.Mutex
+	uploads []*proto.Operations
+	sent    []*proto.SimpleOperations
+	header  metadata.MD
+	trailer metadata.MD
+	// onSend runs before every send, a test can block the stream with it
+	onSend func()
+}
+
+func newTestStream(batches ...[]*proto.Operation) *testStream {
+	uploads := make([]*proto.Operations, 0, len(batches))
+	for _, batch := range batches {
+		uploads = append(uploads, &proto.Operations{Operations: batch})
+	}
+
+	return &testStream{ctx: context.Background(), uploads: uploads}
+}
+
+func (s *testStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testStream) Recv() (*proto.Operations, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if len(s.uploads) == 0 {
+		return nil, io.EOF
+	}
+	batch := s.uploads[0]
+	s.uploads = s.uploads[1:]
+
+	return batch, nil
+}
+
+func (s *testStream) Send(operations *proto.SimpleOperations) error {
+	if s.onSend != nil {
+		s.onSend()
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.sent = append(s.sent, operations)
+
+	return nil
+}
+
+func (s *testStream) SendHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+
+	return nil
+}
+
+func (s *testStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func (s *testStream) operations() []string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	sql := make([]string, 0)
+	for _, batch := range s.sent {
+		for _, op := range batch.Operations {
+			sql = append(sql, op.Sql)
+		}
+	}
+
+	return sql
+}
+
+func (s *testStream) acks() []*proto.OperationAck {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	acks := make([]*proto.OperationAck, 0)
+	for _, batch := range s.sent {
+		acks = append(acks, batch.Acks...)
+	}
+
+	return acks
+}
+
+type testNotifier struct{}
+
+func (testNotifier) Changed(string, string) {}
+
+func newTestService(t *testing.T) (*service, adapters.Repository) {
+	t.Helper()
+
+	cfg := &common.Config{
+		Workers:             2,
+		WorkerPoolBuffer:    1,
+		MaxUploadBatches:    10,
+		MaxUploadOperations: 10,
+		GroupMutex:          common.GroupMutexMemory,
+		LockTimeout:         time.Second,
+		GroupGracePeriod:    time.Hour,
+		InviteTTL:           time.Hour,
+		ClockMaxDrift:       time.Minute,
+	}
+	logger := logrus.NewEntry(logrus.New())
+
+	mx, err := NewGroupMutex(cfg, nil)
+	require.NoError(t, err)
+
+	repo := adapters.NewMemoryRepository()
+	s := NewService(cfg, mx, repo, NewWorkerPool(cfg, logger), NewHub(), testNotifier{}, NewClock(cfg), logger)
+
+	return s.(*service), repo
+}
+
+func insert(id, sql string) *proto.Operation {
+	return &proto.Operation{
+		Id:              id,
+		Type:            proto.OperationType_OPERATION_INSERT,
+		Sql:             sql,
+		RelatedEntities: []*proto.RelatedEntity{{Id: id, Name: "note"}},
+	}
+}
+
+func TestSyncDataDownloadsOperationsOfOtherDevices(t *testing.T) {
+	s, _ := newTestService(t)
+
+	upload := newTestStream([]*proto.Operation{insert("1", "first"), insert("2", "second")})
+	cursor, err := s.SyncData("phone", "alice", upload)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cursor)
+	assert.Len(t, upload.acks(), 2)
+	assert.Empty(t, upload.operations())
+
+	download := newTestStream()
+	_, err = s.SyncData("laptop", "alice", download)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, download.operations())
+
+	again := newTestStream()
+	_, err = s.SyncData("laptop", "alice", again)
+	require.NoError(t, err)
+	assert.Empty(t, again.operations())
+}
+
+func TestSyncDataSkipsRetriedOperations(t *testing.T) {
+	s, _ := newTestService(t)
+
+	first := newTestStream([]*proto.Operation{insert("1", "first")})
+	_, err := s.SyncData("phone", "alice", first)
+	require.NoError(t, err)
+
+	retry := newTestStream([]*proto.Operation{insert("1", "first")})
+	_, err = s.SyncData("phone", "alice", retry)
+	require.NoError(t, err)
+	assert.Equal(t, first.acks(), retry.acks())
+
+	download := newTestStream()
+	_, err = s.SyncData("laptop", "alice", download)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first"}, download.operations())
+}
+
+func TestSyncDataRejectsTooLargeUploads(t *testing.T) {
+	s, repo := newTestService(t)
+
+	batch := make([]*proto.Operation, 0, 11)
+	for i := 0; i < 11; i++ {
+		batch = append(batch, insert(string(rune('a'+i)), "insert"))
+	}
+
+	stream := newTestStream(batch)
+	_, err := s.SyncData("phone", "alice", stream)
+	assert.ErrorIs(t, err, ErrUploadTooLarge)
+	assert.Equal(t, []string{"10"}, stream.header.Get(maxUploadBatchesHeader))
+	assert.Equal(t, []string{"10"}, stream.header.Get(maxUploadOperationsHeader))
+
+	operations, err := repo.GetAllData("alice")
+	require.NoError(t, err)
+	assert.Empty(t, operations)
+}
+
+func TestViewerCannotUpload(t *testing.T) {
+	s, _ := newTestService(t)
+
+	_, err := s.SyncData("alice-phone", "alice", newTestStream())
+	require.NoError(t, err)
+	invite, err := s.CreateInvite("alice-phone", "alice", 0, false, common.RoleViewer)
+	require.NoError(t, err)
+
+	_, err = s.JoinGroup("bob-phone", "bob", invite.Code, false, newTestStream())
+	require.NoError(t, err)
+
+	_, err = s.SyncData("bob-phone", "bob", newTestStream([]*proto.Operation{insert("1", "first")}))
+	assert.ErrorIs(t, err, ErrReadOnly)
+}
+
+func TestLeaveGroupWithDataDoesNotDownloadItAgain(t *testing.T) {
+	s, _ := newTestService(t)
+
+	_, err := s.SyncData("alice-phone", "alice", newTestStream([]*proto.Operation{insert("1", "first")}))
+	require.NoError(t, err)
+	invite, err := s.CreateInvite("alice-phone", "alice", 0, false, "")
+	require.NoError(t, err)
+
+	join := newTestStream()
+	_, err = s.JoinGroup("bob-phone", "bob", invite.Code, false, join)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first"}, join.operations())
+
+	_, err = s.SyncData("alice-phone", "alice", newTestStream([]*proto.Operation{insert("2", "second")}))
+	require.NoError(t, err)
+
+	require.NoError(t, s.LeaveGroup(context.Background(), "bob-phone", "bob", true))
+
+	// the second operation was never downloaded, the first one was
+	download := newTestStream()
+	_, err = s.SyncData("bob-phone", "bob", download)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"second"}, download.operations())
+}
+
+func TestOwnerCannotLeaveGroupWithMembers(t *testing.T) {
+	s, _ := newTestService(t)
+
+	_, err := s.SyncData("alice-phone", "alice", newTestStream())
+	require.NoError(t, err)
+	invite, err := s.CreateInvite("alice-phone", "alice", 0, false, "")
+	require.NoError(t, err)
+	_, err = s.JoinGroup("bob-phone", "bob", invite.Code, false, newTestStream())
+	require.NoError(t, err)
+
+	require.NoError(t, s.TransferOwnership(context.Background(), "alice-phone", "alice", "bob"))
+
+	err = s.LeaveGroup(context.Background(), "bob-phone", "bob", false)
+	assert.ErrorIs(t, err, ErrOwnerLeaving)
+}
+
+func TestSyncDataResyncsPrunedDevices(t *testing.T) {
+	s, repo := newTestService(t)
+
+	_, err := s.SyncData("phone", "alice", newTestStream([]*proto.Operation{insert("1", "first")}))
+	require.NoError(t, err)
+	_, err = s.SyncData("laptop", "alice", newTestStream())
+	require.NoError(t, err)
+	_, err = s.SyncData("phone", "alice", newTestStream([]*proto.Operation{insert("2", "second")}))
+	require.NoError(t, err)
+
+	// the laptop has the first operation only, the second one exists only in the snapshot
+	operations, err := repo.GetAllData("alice")
+	require.NoError(t, err)
+	require.NoError(t, repo.SaveSnapshot(&common.Snapshot{GroupId: "alice", Watermark: 2, Operations: operations}))
+	require.NoError(t, repo.PruneData("alice", 2))
+
+	download := newTestStream()
+	_, err = s.SyncData("laptop", "alice", download)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"true"}, download.header.Get(fullResyncHeader))
+	assert.Equal(t, []string{"first", "second"}, download.operations())
+}
+
+func TestJoinGroupByGroupID(t *testing.T) {
+	s, repo := newTestService(t)
+
+	_, err := s.SyncData("alice-phone", "alice", newTestStream([]*proto.Operation{insert("1", "first")}))
+	require.NoError(t, err)
+
+	s.legacyGroupJoin = false
+	_, err = s.JoinGroup("bob-phone", "bob", "alice", false, newTestStream())
+	assert.ErrorIs(t, err, ErrInviteNotFound)
+
+	s.legacyGroupJoin = true
+	join := newTestStream()
+	_, err = s.JoinGroup("bob-phone", "bob", "alice", false, join)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first"}, join.operations())
+
+	member, err := repo.GetMember("alice", "bob")
+	require.NoError(t, err)
+	assert.Equal(t, common.RoleEditor, member.Role)
+
+	_, err = s.JoinGroup("carol-phone", "carol", "nobody", false, newTestStream())
+	assert.ErrorIs(t, err, ErrGroupNotFound)
+}
+
+func TestSetMemberRole(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.SyncData("alice-phone", "alice", newTestStream())
+	require.NoError(t, err)
+	invite, err := s.CreateInvite("alice-phone", "alice", 0, false, "")
+	require.NoError(t, err)
+	_, err = s.JoinGroup("bob-phone", "bob", invite.Code, false, newTestStream())
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, s.SetMemberRole(ctx, "bob-phone", "bob", "alice", common.RoleViewer), ErrPermissionDenied)
+	assert.ErrorIs(t, s.SetMemberRole(ctx, "alice-phone", "alice", "bob", common.RoleOwner), ErrInvalidRole)
+	require.NoError(t, s.SetMemberRole(ctx, "alice-phone", "alice", "bob", common.RoleViewer))
+
+	_, err = s.SyncData("bob-phone", "bob", newTestStream([]*proto.Operation{insert("1", "first")}))
+	assert.ErrorIs(t, err, ErrReadOnly)
+}
+
+func TestRemoveMember(t *testing.T) {
+	s, repo := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.SyncData("alice-phone", "alice", newTestStream([]*proto.Operation{insert("1", "first")}))
+	require.NoError(t, err)
+	invite, err := s.CreateInvite("alice-phone", "alice", 0, false, "")
+	require.NoError(t, err)
+	_, err = s.JoinGroup("bob-phone", "bob", invite.Code, false, newTestStream())
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, s.RemoveMember(ctx, "bob-phone", "bob", "alice"), ErrPermissionDenied)
+	require.NoError(t, s.RemoveMember(ctx, "alice-phone", "alice", "bob"))
+
+	groupID, err := s.repo.GetGroupID("bob-phone", "bob")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", groupID)
+
+	members, err := s.ListMembers("alice-phone", "alice")
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	assert.Equal(t, "alice", members[0].UserId)
+
+	// the removed member keeps a copy of the data the devices have already
+	operations, err := repo.GetAllData("bob")
+	require.NoError(t, err)
+	assert.Len(t, operations, 1)
+	download := newTestStream()
+	_, err = s.SyncData("bob-phone", "bob", download)
+	require.NoError(t, err)
+	assert.Empty(t, download.operations())
+}
+
+func TestSubscribePushesOperationsOfOtherDevices(t *testing.T) {
+	s, _ := newTestService(t)
+
+	_, err := s.SyncData("phone", "alice", newTestStream([]*proto.Operation{insert("1", "first")}))
+	require.NoError(t, err)
+	_, err = s.SyncData("laptop", "alice", newTestStream())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	subscription := newTestStream()
+	subscription.ctx = ctx
+	done := make(chan error, 1)
+	go func() { done <- s.Subscribe("laptop", "alice", subscription) }()
+
+	_, err = s.SyncData("phone", "alice", newTestStream([]*proto.Operation{insert("2", "second")}))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(subscription.operations()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"second"}, subscription.operations())
+
+	cancel()
+	require.NoError(t, <-done)
+
+	// the pushed operation is not downloaded again
+	download := newTestStream()
+	_, err = s.SyncData("laptop", "alice", download)
+	require.NoError(t, err)
+	assert.Empty(t, download.operations())
+}
+
+func TestJoinGroupKeepsDataOfSharedGroup(t *testing.T) {
+	s, repo := newTestService(t)
+
+	_, err := s.SyncData("alice-phone", "alice", newTestStream([]*proto.Operation{insert("1", "first")}))
+	require.NoError(t, err)
+	invite, err := s.CreateInvite("alice-phone", "alice", 0, false, "")
+	require.NoError(t, err)
+	_, err = s.JoinGroup("bob-phone", "bob", invite.Code, false, newTestStream())
+	require.NoError(t, err)
+
+	_, err = s.SyncData("carol-phone", "carol", newTestStream())
+	require.NoError(t, err)
+	invite, err = s.CreateInvite("carol-phone", "carol", 0, false, "")
+	require.NoError(t, err)
+	_, err = s.JoinGroup("bob-phone", "bob", invite.Code, true, newTestStream())
+	require.NoError(t, err)
+
+	_, err = s.SyncData("alice-phone", "alice", newTestStream([]*proto.Operation{insert("2", "second")}))
+	require.NoError(t, err)
+	operations, err := repo.GetAllData("alice")
+	require.NoError(t, err)
+	assert.Len(t, operations, 2)
+
+	// bob took a copy of the data along
+	download := newTestStream()
+	_, err = s.SyncData("carol-phone", "carol", download)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first"}, download.operations())
+}
+
+func TestSyncDataWaitsForPushToTheDevice(t *testing.T) {
+	s, _ := newTestService(t)
+
+	_, err := s.SyncData("phone", "alice", newTestStream([]*proto.Operation{insert("1", "first")}))
+	require.NoError(t, err)
+	_, err = s.SyncData("laptop", "alice", newTestStream())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sending, release := make(chan struct{}), make(chan struct{})
+	subscription := newTestStream()
+	subscription.ctx = ctx
+	subscription.onSend = func() {
+		close(sending)
+		<-release
+	}
+	go func() { _ = s.Subscribe("laptop", "alice", subscription) }()
+
+	_, err = s.SyncData("phone", "alice", newTestStream([]*proto.Operation{insert("2", "second")}))
+	require.NoError(t, err)
+	<-sending
+
+	download := newTestStream()
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.SyncData("laptop", "alice", download)
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("sync finished while operations were pushed to the device")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-done)
+	assert.Equal(t, []string{"second"}, subscription.operations())
+	assert.Empty(t, download.operations())
+}
+
+func TestSyncDataFailsIfTheDeviceMovedWhileWaiting(t *testing.T) {
+	s, repo := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.SyncData("phone", "alice", newTestStream())
+	require.NoError(t, err)
+
+	require.NoError(t, s.lock(ctx, "alice"))
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.SyncData("phone", "alice", newTestStream([]*proto.Operation{insert("1", "first")}))
+		done <- err
+	}()
+
+	// the sync holds the device and waits for the group
+	assert.Eventually(t, func() bool { return s.mx.Size() == 2 }, time.Second, time.Millisecond)
+	require.NoError(t, repo.UpdateGroupID("alice", "other"))
+	s.unlock("alice")
+
+	assert.ErrorIs(t, <-done, ErrGroupChanged)
+	operations, err := repo.GetAllData("alice")
+	require.NoError(t, err)
+	assert.Empty(t, operations)
+}
+
+func fieldWriteOperation(id string, timestamp int64, value string) *proto.Operation {
+	return &proto.Operation{
+		Id:   id,
+		Type: proto.OperationType_OPERATION_UPDATE,
+		Args: `{"field_write": {"entity": "note", "entity_id": "1", "field": "title", "value": "` + value +
+			`", "timestamp": ` + strconv.FormatInt(timestamp, 10) + `}}`,
+	}
+}
+
+func TestSyncDataResolvesFieldWrites(t *testing.T) {
+	s, _ := newTestService(t)
+
+	// operations without Sql and without the field_write key are not structured
+	legacy := &proto.Operation{Id: "legacy", Type: proto.OperationType_OPERATION_INSERT, Args: "[1]"}
+	first := newTestStream([]*proto.Operation{legacy, fieldWriteOperation("old", 2, "old")})
+	_, err := s.SyncData("phone", "alice", first)
+	require.NoError(t, err)
+	require.Len(t, first.acks(), 2)
+
+	_, err = s.SyncData("laptop", "alice", newTestStream([]*proto.Operation{fieldWriteOperation("new", 3, "new")}))
+	require.NoError(t, err)
+
+	// the retry of a stored write keeps its sequence, a write older than the latest one never gets one
+	retry := newTestStream([]*proto.Operation{fieldWriteOperation("old", 2, "old"), fieldWriteOperation("older", 1, "older")})
+	_, err = s.SyncData("phone", "alice", retry)
+	require.NoError(t, err)
+	assert.Equal(t, []*proto.OperationAck{{Id: "old", Sequence: first.acks()[1].Sequence}, {Id: "older"}}, retry.acks())
+
+	_, err = s.SyncData("phone", "alice", newTestStream([]*proto.Operation{{Type: proto.OperationType_OPERATION_INSERT, Args: `{"field_write": {}}`}}))
+	assert.ErrorIs(t, err, ErrInvalidOperation)
+}
+
+func TestLockGivesUpOnBusyGroup(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		ctx     context.Context
+		err     error
+	}{
+		{name: "timeout", timeout: 10 * time.Millisecond, ctx: context.Background(), err: ErrLockTimeout},
+		{name: "cancelled context", timeout: time.Minute, ctx: cancelled, err: ErrLockAborted},
+		{name: "no timeout", timeout: 0, ctx: context.Background(), err: ErrLockAborted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mx, err := NewGroupMutex(&common.Config{GroupMutex: common.GroupMutexMemory}, nil)
+			require.NoError(t, err)
+			s := &service{mx: mx, lockTimeout: tt.timeout, logger: logrus.NewEntry(logrus.New())}
+
+			require.NoError(t, s.lock(context.Background(), "group"))
+			assert.ErrorIs(t, s.lock(tt.ctx, "group"), tt.err)
+
+			// the wait gave the slot up, so the group is free once its holder unlocks it
+			s.unlock("group")
+			require.NoError(t, s.lock(context.Background(), "group"))
+			s.unlock("group")
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package logic
+
+import (
+	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
+	"github.com/Gregmus2/sync-service/internal/common"
+)
+
+const operationInsert = "OPERATION_INSERT"
+
+// squash drops operations superseded by later operations on the same entity, so only the net effect is replayed.
+// Operations up to id seen may already be applied by a reader.
+func squash(operations []common.LoggedOperation, seen int64) []common.LoggedOperation {
+	dropped := superseded(operations, seen)
+	if len(dropped) == 0 {
+		return operations
+	}
+
+	kept := make([]common.LoggedOperation, 0, len(operations)-len(dropped))
+	for _, op := range operations {
+		if _, ok := dropped[op.ID]; !ok {
+			kept = append(kept, op)
+		}
+	}
+
+	return kept
+}
+
+// superseded returns ids of operations without effect on the result of replaying the log. Sql of operations is
+// opaque, so only a delete collapses the history of an entity: everything before the last delete goes away,
+// and the delete itself too if the entity was inserted after seen, because then nobody has the row. After the
+// last delete only the newest structured write of every field stays. An entity also touched by an operation on
+// several entities is left as is, that operation may depend on the row.
+func superseded(operations []common.LoggedOperation, seen int64) map[int]struct{} {
+	history := make(map[common.RelatedEntity][]common.LoggedOperation)
+	shared := make(map[common.RelatedEntity]struct{})
+	for _, op := range operations {
+		switch len(op.Entities) {
+		case 0:
+		case 1:
+			key := entityKey(op.Entities[0])
+			history[key] = append(history[key], op)
+		default:
+			for _, entity := range op.Entities {
+				shared[entityKey(entity)] = struct{}{}
+			}
+		}
+	}
+
+	dropped := make(map[int]struct{})
+	for key, ops := range history {
+		if _, ok := shared[key]; ok {
+			continue
+		}
+
+		last := -1
+		for i, op := range ops {
+			if op.OperationType == operationDelete {
+				last = i
+			}
+		}
+
+		if last != -1 {
+			end := last
+			if ops[0].OperationType == operationInsert && int64(ops[0].ID) > seen {
+				end++
+			}
+			for _, op := range ops[:end] {
+				dropped[op.ID] = struct{}{}
+			}
+		}
+
+		// writes are applied only if they are newer, so an older write has no effect wherever it is in the log
+		latest := make(map[string]*common.FieldWrite)
+		latestID := make(map[string]int)
+		for _, op := range ops[last+1:] {
+			write, err := parseFieldWrite(op.OperationType, op.Sql, op.Args)
+			if err != nil || write == nil {
+				continue
+			}
+
+			current, ok := latest[write.Field]
+			switch {
+			case !ok:
+			case newer(write, current):
+				dropped[latestID[write.Field]] = struct{}{}
+			default:
+				dropped[op.ID] = struct{}{}
+
+				continue
+			}
+			latest[write.Field] = write.model("")
+			latestID[write.Field] = op.ID
+		}
+	}
+
+	return dropped
+}
+
+func entityKey(entity common.RelatedEntity) common.RelatedEntity {
+	return common.RelatedEntity{EntityID: entity.EntityID, EntityName: entity.EntityName}
+}
+
+func simpleOperations(operations []common.LoggedOperation) []*proto.SimpleOperation {
+	result := make([]*proto.SimpleOperation, 0, len(operations))
+	for _, op := range operations {
+		result = append(result, &proto.SimpleOperation{Sql: op.Sql, Args: op.Args})
+	}
+
+	return result
+}
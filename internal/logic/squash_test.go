@@ -0,0 +1,114 @@
+package logic
+
+import (
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func loggedOperation(id int, operationType string, entities ...string) common.LoggedOperation {
+	op := common.LoggedOperation{ID: id, OperationType: operationType, Sql: operationType}
+	for _, entity := range entities {
+		op.Entities = append(op.Entities, common.RelatedEntity{OperationID: id, EntityID: entity, EntityName: "note"})
+	}
+
+	return op
+}
+
+func TestSquash(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations []common.LoggedOperation
+		seen       int64
+		kept       []int
+	}{
+		{
+			name: "insert and delete not seen by the reader",
+			operations: []common.LoggedOperation{
+				loggedOperation(1, operationInsert, "1"),
+				loggedOperation(2, operationDelete, "1"),
+			},
+			seen: 0,
+			kept: []int{},
+		},
+		{
+			name: "insert seen by the reader before the delete",
+			operations: []common.LoggedOperation{
+				loggedOperation(1, operationInsert, "1"),
+				loggedOperation(2, operationDelete, "1"),
+			},
+			seen: 1,
+			kept: []int{2},
+		},
+		{
+			name: "re-insert after delete",
+			operations: []common.LoggedOperation{
+				loggedOperation(1, operationInsert, "1"),
+				loggedOperation(2, operationDelete, "1"),
+				loggedOperation(3, operationInsert, "1"),
+			},
+			seen: 0,
+			kept: []int{3},
+		},
+		{
+			name: "re-insert after delete of a seen row",
+			operations: []common.LoggedOperation{
+				loggedOperation(1, operationInsert, "1"),
+				loggedOperation(2, operationDelete, "1"),
+				loggedOperation(3, operationInsert, "1"),
+			},
+			seen: 1,
+			kept: []int{2, 3},
+		},
+		{
+			name: "update before delete",
+			operations: []common.LoggedOperation{
+				loggedOperation(1, operationUpdate, "1"),
+				loggedOperation(2, operationUpdate, "1"),
+				loggedOperation(3, operationDelete, "1"),
+			},
+			seen: 0,
+			kept: []int{3},
+		},
+		{
+			name: "updates without delete",
+			operations: []common.LoggedOperation{
+				loggedOperation(1, operationInsert, "1"),
+				loggedOperation(2, operationUpdate, "1"),
+			},
+			seen: 0,
+			kept: []int{1, 2},
+		},
+		{
+			name: "entity shared with another operation",
+			operations: []common.LoggedOperation{
+				loggedOperation(1, operationInsert, "1"),
+				loggedOperation(2, operationUpdate, "1", "2"),
+				loggedOperation(3, operationDelete, "1"),
+			},
+			seen: 0,
+			kept: []int{1, 2, 3},
+		},
+		{
+			name: "other entities and operations without entities",
+			operations: []common.LoggedOperation{
+				loggedOperation(1, operationInsert, "1"),
+				loggedOperation(2, operationInsert, "2"),
+				loggedOperation(3, operationUpdate),
+				loggedOperation(4, operationDelete, "1"),
+			},
+			seen: 0,
+			kept: []int{2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept := make([]int, 0)
+			for _, op := range squash(tt.operations, tt.seen) {
+				kept = append(kept, op.ID)
+			}
+			assert.Equal(t, tt.kept, kept)
+		})
+	}
+}
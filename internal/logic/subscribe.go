@@ -0,0 +1,126 @@
+package logic
+
+import (
+	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
+	"github.com/pkg/errors"
+)
+
+func (s *service) Subscribe(deviceToken, userID string, stream Subscriber) error {
+	ctx := stream.Context()
+
+	groupID, err := s.repo.GetGroupID(deviceToken, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get group id")
+	}
+
+	if _, err = memberRole(s.repo, groupID, userID); err != nil {
+		return err
+	}
+
+	sub := s.hub.Subscribe(groupID, deviceToken)
+	defer s.hub.Unsubscribe(sub)
+
+	// operations committed between the last sync and the subscription are pushed right away
+	for {
+		current, err := s.repo.GetGroupID(deviceToken, userID)
+		if err != nil {
+			return errors.Wrap(err, "failed to get group id")
+		}
+		// the device subscribes again to its new group
+		if current != groupID {
+			return nil
+		}
+
+		err = s.push(deviceToken, userID, groupID, stream)
+		if errors.Is(err, ErrGroupChanged) || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sub.C:
+		}
+	}
+}
+
+// push sends operations of other devices after the device cursor, like SyncData does without uploads, and moves the
+// cursor past them once they are sent. The device stays locked until then, so a sync of the device doesn't download
+// them again, while the group is locked only to load them and to move the cursor: a slow subscriber holds back
+// nobody but itself, sending blocks on the flow control of its stream and the hub coalesces the signals meanwhile.
+func (s *service) push(deviceToken, userID, groupID string, stream Subscriber) error {
+	if err := s.lockDevice(stream.Context(), deviceToken); err != nil {
+		return err
+	}
+	defer s.unlockDevice(deviceToken)
+
+	data, last, err := s.pending(stream, deviceToken, userID, groupID)
+	if err != nil || last == 0 {
+		return err
+	}
+
+	if err = sendOperations(stream, data); err != nil {
+		return err
+	}
+
+	if err = s.lock(stream.Context(), groupID); err != nil {
+		return err
+	}
+	defer s.unlock(groupID)
+
+	// ids are global, the cursor must not move past operations of a group the device moved to meanwhile
+	if err = s.sameGroup(deviceToken, userID, groupID); err != nil {
+		return err
+	}
+
+	if err = s.repo.AdvanceDeviceCursor(deviceToken, last); err != nil {
+		return errors.Wrap(err, "failed to advance device cursor")
+	}
+
+	return nil
+}
+
+// pending returns operations to push squashed to their net effect and the id of the last of them, zero if there is
+// nothing to push.
+func (s *service) pending(stream Subscriber, deviceToken, userID, groupID string) ([]*proto.SimpleOperation, int64, error) {
+	if err := s.lock(stream.Context(), groupID); err != nil {
+		return nil, 0, err
+	}
+	defer s.unlock(groupID)
+
+	if err := s.sameGroup(deviceToken, userID, groupID); err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := s.repo.GetCursor(deviceToken)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to get device cursor")
+	}
+
+	snapshot, err := s.repo.GetSnapshot(groupID)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to get snapshot")
+	}
+	// a new or pruned device has to bootstrap with SyncData first
+	if cursor == 0 || isPruned(snapshot, cursor) {
+		return nil, 0, nil
+	}
+
+	operations, err := s.repo.GetData(deviceToken, groupID)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to get data")
+	}
+
+	// operations are ordered by their clock, not by id
+	var last int64
+	for _, op := range operations {
+		if int64(op.ID) > last {
+			last = int64(op.ID)
+		}
+	}
+
+	return simpleOperations(squash(operations, cursor)), last, nil
+}
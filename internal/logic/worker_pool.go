@@ -2,33 +2,35 @@ package logic
 
 import (
 	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
-	"github.com/Gregmus2/sync-service/internal/adapters"
 	"github.com/Gregmus2/sync-service/internal/common"
-	"github.com/Gregmus2/sync-service/internal/interceptors"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"io"
-	"sync"
 )
 
 type workerPool struct {
-	in     chan job
-	repo   adapters.Repository
-	logger *logrus.Entry
+	in            chan job
+	maxOperations int
+	maxBatches    int
+	logger        *logrus.Entry
 }
 
+// job either receives uploads of stream or runs fn
 type job struct {
-	stream  proto.SyncService_SyncDataServer
-	wg      *sync.WaitGroup
-	groupID string
+	stream proto.SyncService_SyncDataServer
+	result chan Upload
+
+	fn   func() error
+	done chan error
 }
 
-func NewWorkerPool(cfg *common.Config, repo adapters.Repository, logger *logrus.Entry) WorkerPool {
+func NewWorkerPool(cfg *common.Config, logger *logrus.Entry) WorkerPool {
 	in := make(chan job, cfg.WorkerPoolBuffer)
 	pool := &workerPool{
-		in:     in,
-		repo:   repo,
-		logger: logger,
+		in:            in,
+		maxOperations: cfg.MaxUploadOperations,
+		maxBatches:    cfg.MaxUploadBatches,
+		logger:        logger,
 	}
 
 	for i := 0; i < cfg.Workers; i++ {
@@ -38,41 +40,59 @@ func NewWorkerPool(cfg *common.Config, repo adapters.Repository, logger *logrus.
 	return pool
 }
 
-func (wp workerPool) Add(stream proto.SyncService_SyncDataServer, groupID string) *sync.WaitGroup {
-	var wg sync.WaitGroup
-	wg.Add(1)
+func (wp workerPool) Add(stream proto.SyncService_SyncDataServer) <-chan Upload {
+	// buffered, so the worker doesn't block when the caller has already given up on the result
+	result := make(chan Upload, 1)
+	wp.in <- job{
+		stream: stream,
+		result: result,
+	}
+
+	return result
+}
+
+func (wp workerPool) Run(fn func() error) error {
+	done := make(chan error, 1)
 	wp.in <- job{
-		stream:  stream,
-		wg:      &wg,
-		groupID: groupID,
+		fn:   fn,
+		done: done,
 	}
 
-	return &wg
+	return <-done
 }
 
 func (wp workerPool) worker(in chan job) {
 	for j := range in {
-		deviceToken := j.stream.Context().Value(interceptors.ContextDeviceToken).(string)
+		if j.fn != nil {
+			j.done <- j.fn()
 
-		for {
-			operations, err := j.stream.Recv()
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			if err != nil {
-				wp.logger.WithError(err).Error("failed to receive data")
+			continue
+		}
+
+		j.result <- wp.receive(j)
+	}
+}
 
-				break
-			}
+func (wp workerPool) receive(j job) Upload {
+	batches := make([][]*proto.Operation, 0)
+	operations := 0
+	for {
+		batch, err := j.stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return Upload{Batches: batches}
+		}
+		if err != nil {
+			wp.logger.WithError(err).Error("failed to receive data")
 
-			err = wp.repo.InsertData(deviceToken, j.groupID, operations.Operations)
-			if err != nil {
-				wp.logger.WithError(err).Error("failed to insert data")
+			return Upload{Err: errors.Wrap(ErrUploadFailed, "failed to receive data")}
+		}
 
-				break
-			}
+		// the whole upload is buffered until it is committed, so its size is bounded
+		operations += len(batch.Operations)
+		if len(batches) == wp.maxBatches || operations > wp.maxOperations {
+			return Upload{Err: ErrUploadTooLarge}
 		}
 
-		j.wg.Done()
+		batches = append(batches, batch.Operations)
 	}
 }
@@ -1,16 +1,46 @@
 package mocks
 
-import "github.com/stretchr/testify/mock"
+import (
+	"context"
+	"github.com/stretchr/testify/mock"
+)
 
 // MockGroupMutex is a mock of the GroupMutex interface
 type MockGroupMutex struct {
 	mock.Mock
 }
 
-func (m *MockGroupMutex) Lock(groupID string) {
-	m.Called(groupID)
+func (m *MockGroupMutex) Lock(ctx context.Context, groupID string) error {
+	args := m.Called(ctx, groupID)
+	return args.Error(0)
 }
 
-func (m *MockGroupMutex) Unlock(groupID string) {
-	m.Called(groupID)
+func (m *MockGroupMutex) TryLock(groupID string) (bool, error) {
+	args := m.Called(groupID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockGroupMutex) Unlock(groupID string) error {
+	args := m.Called(groupID)
+	return args.Error(0)
+}
+
+func (m *MockGroupMutex) LockMany(ctx context.Context, groupIDs ...string) error {
+	args := m.Called(ctx, groupIDs)
+	return args.Error(0)
+}
+
+func (m *MockGroupMutex) TryLockMany(groupIDs ...string) (bool, error) {
+	args := m.Called(groupIDs)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockGroupMutex) UnlockMany(groupIDs ...string) error {
+	args := m.Called(groupIDs)
+	return args.Error(0)
+}
+
+func (m *MockGroupMutex) Size() int {
+	args := m.Called()
+	return args.Int(0)
 }
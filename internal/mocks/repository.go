@@ -2,6 +2,8 @@ package mocks
 
 import (
 	proto "github.com/Gregmus2/sync-proto-gen/go/sync"
+	"github.com/Gregmus2/sync-service/internal/adapters"
+	"github.com/Gregmus2/sync-service/internal/common"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -9,29 +11,39 @@ type MockRepository struct {
 	mock.Mock
 }
 
-func (m *MockRepository) UpdateDeviceTokenTime(deviceToken, userID, groupID string) error {
-	args := m.Called(deviceToken, userID, groupID)
+func (m *MockRepository) WithTx(fn func(repo adapters.Repository) error) error {
+	args := m.Called(fn)
 	return args.Error(0)
 }
 
-func (m *MockRepository) InsertData(deviceToken, groupID string, operations []*proto.Operation) error {
-	args := m.Called(deviceToken, groupID, operations)
+func (m *MockRepository) UpdateDeviceCursor(deviceToken, userID, groupID string) (int64, error) {
+	args := m.Called(deviceToken, userID, groupID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) AdvanceDeviceCursor(deviceToken string, cursor int64) error {
+	args := m.Called(deviceToken, cursor)
 	return args.Error(0)
 }
 
+func (m *MockRepository) InsertData(deviceToken, groupID string, operations []*proto.Operation, stamps []int64) ([]*proto.OperationAck, error) {
+	args := m.Called(deviceToken, groupID, operations, stamps)
+	return args.Get(0).([]*proto.OperationAck), args.Error(1)
+}
+
 func (m *MockRepository) CleanConflicted(deviceToken, groupID string) error {
 	args := m.Called(deviceToken, groupID)
 	return args.Error(0)
 }
 
-func (m *MockRepository) GetGroupID(userID string) (string, error) {
-	args := m.Called(userID)
+func (m *MockRepository) GetGroupID(deviceToken, userID string) (string, error) {
+	args := m.Called(deviceToken, userID)
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockRepository) GetData(deviceToken, groupID string) ([]*proto.Operation, error) {
+func (m *MockRepository) GetData(deviceToken, groupID string) ([]common.LoggedOperation, error) {
 	args := m.Called(deviceToken, groupID)
-	return args.Get(0).([]*proto.Operation), args.Error(1)
+	return args.Get(0).([]common.LoggedOperation), args.Error(1)
 }
 
 func (m *MockRepository) UpdateGroupID(userID, newGroupID string) error {
@@ -44,17 +56,161 @@ func (m *MockRepository) MigrateData(fromID, toID string) error {
 	return args.Error(0)
 }
 
-func (m *MockRepository) RemoveData(userID string) error {
-	args := m.Called(userID)
+func (m *MockRepository) RemoveData(groupID string) error {
+	args := m.Called(groupID)
 	return args.Error(0)
 }
 
-func (m *MockRepository) GetAllData(groupID string) ([]*proto.Operation, error) {
+func (m *MockRepository) GetAllData(groupID string) ([]common.LoggedOperation, error) {
 	args := m.Called(groupID)
-	return args.Get(0).([]*proto.Operation), args.Error(1)
+	return args.Get(0).([]common.LoggedOperation), args.Error(1)
 }
 
-func (m *MockRepository) CopyOperations(fromID, toID string) error {
+func (m *MockRepository) CopyOperations(fromID, toID string) ([]common.CopiedOperation, error) {
 	args := m.Called(fromID, toID)
+	return args.Get(0).([]common.CopiedOperation), args.Error(1)
+}
+
+func (m *MockRepository) IsGroupExists(groupID string) (bool, error) {
+	args := m.Called(groupID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetOperationID(groupID, clientOperationID string) (int64, error) {
+	args := m.Called(groupID, clientOperationID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) GetCursor(deviceToken string) (int64, error) {
+	args := m.Called(deviceToken)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) GetLog(groupID string, after int64) ([]common.LoggedOperation, error) {
+	args := m.Called(groupID, after)
+	return args.Get(0).([]common.LoggedOperation), args.Error(1)
+}
+
+func (m *MockRepository) GetSnapshot(groupID string) (*common.Snapshot, error) {
+	args := m.Called(groupID)
+	snapshot, _ := args.Get(0).(*common.Snapshot)
+	return snapshot, args.Error(1)
+}
+
+func (m *MockRepository) SaveSnapshot(snapshot *common.Snapshot) error {
+	args := m.Called(snapshot)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetGroupsToCompact(threshold int) ([]string, error) {
+	args := m.Called(threshold)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRepository) GetMaxHLC(groupID string) (int64, error) {
+	args := m.Called(groupID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) GetMaxCursor(groupID string) (int64, error) {
+	args := m.Called(groupID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) RemoveOperations(ids []int) error {
+	args := m.Called(ids)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetGroupDevices(groupID string) ([]common.DeviceToken, error) {
+	args := m.Called(groupID)
+	return args.Get(0).([]common.DeviceToken), args.Error(1)
+}
+
+func (m *MockRepository) PruneData(groupID string, upTo int64) error {
+	args := m.Called(groupID, upTo)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetGroupsToPrune() ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRepository) MarkGroupAbandoned(groupID string, at int64) error {
+	args := m.Called(groupID, at)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UnmarkGroupAbandoned(groupID string) error {
+	args := m.Called(groupID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetAbandonedGroups(before int64) ([]string, error) {
+	args := m.Called(before)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRepository) CreateInvite(invite *common.Invite) error {
+	args := m.Called(invite)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetInvite(code string) (*common.Invite, error) {
+	args := m.Called(code)
+	invite, _ := args.Get(0).(*common.Invite)
+	return invite, args.Error(1)
+}
+
+func (m *MockRepository) GetInvites(groupID string) ([]common.Invite, error) {
+	args := m.Called(groupID)
+	return args.Get(0).([]common.Invite), args.Error(1)
+}
+
+func (m *MockRepository) RemoveInvite(code string) error {
+	args := m.Called(code)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RemoveExpiredInvites(before int64) error {
+	args := m.Called(before)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetMember(groupID, userID string) (*common.Member, error) {
+	args := m.Called(groupID, userID)
+	member, _ := args.Get(0).(*common.Member)
+	return member, args.Error(1)
+}
+
+func (m *MockRepository) SaveMember(member *common.Member) error {
+	args := m.Called(member)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RemoveMember(groupID, userID string) error {
+	args := m.Called(groupID, userID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetMembers(groupID string) ([]common.Member, error) {
+	args := m.Called(groupID)
+	return args.Get(0).([]common.Member), args.Error(1)
+}
+
+func (m *MockRepository) GetFieldWrite(groupID, entityName, entityID, field string) (*common.FieldWrite, error) {
+	args := m.Called(groupID, entityName, entityID, field)
+	write, _ := args.Get(0).(*common.FieldWrite)
+	return write, args.Error(1)
+}
+
+func (m *MockRepository) SaveFieldWrite(write *common.FieldWrite) error {
+	args := m.Called(write)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RemoveFieldWrites(groupID, entityName, entityID string) error {
+	args := m.Called(groupID, entityName, entityID)
 	return args.Error(0)
 }
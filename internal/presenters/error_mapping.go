@@ -9,7 +9,21 @@ import (
 
 func NewErrorMapping() interceptors.ErrorMapping {
 	return interceptors.ErrorMapping{
-		logic.ErrGroupNotFound: status.Error(codes.NotFound, "group not found"),
-		logic.ErrNotInGroup:    status.Error(codes.InvalidArgument, "you can't leave own group"),
+		logic.ErrGroupNotFound:    status.Error(codes.NotFound, "group not found"),
+		logic.ErrNotInGroup:       status.Error(codes.InvalidArgument, "you can't leave own group"),
+		logic.ErrAlreadyInGroup:   status.Error(codes.AlreadyExists, "you are already in this group"),
+		logic.ErrLockTimeout:      status.Error(codes.DeadlineExceeded, "group is busy, try again later"),
+		logic.ErrLockAborted:      status.Error(codes.Aborted, "group is busy, try again later"),
+		logic.ErrUploadFailed:     status.Error(codes.Aborted, "failed to store uploaded operations, sync again"),
+		logic.ErrUploadTooLarge:   status.Error(codes.ResourceExhausted, "upload exceeds the sync-max-upload-batches or sync-max-upload-operations header, send it in several syncs"),
+		logic.ErrInviteNotFound:   status.Error(codes.NotFound, "invite not found or expired"),
+		logic.ErrPermissionDenied: status.Error(codes.PermissionDenied, "only the group owner can do this"),
+		logic.ErrReadOnly:         status.Error(codes.PermissionDenied, "read-only members can't upload operations"),
+		logic.ErrInvalidRole:      status.Error(codes.InvalidArgument, "role must be editor or viewer"),
+		logic.ErrMemberNotFound:   status.Error(codes.NotFound, "member not found"),
+		logic.ErrGroupChanged:     status.Error(codes.Aborted, "the group changed meanwhile, try again"),
+		logic.ErrOwnerLeaving:     status.Error(codes.FailedPrecondition, "transfer the group ownership before leaving it"),
+		logic.ErrInvalidOperation: status.Error(codes.InvalidArgument, "structured operation must be an update of entity, entity_id, field and value"),
+		logic.ErrInvalidClock:     status.Error(codes.InvalidArgument, "operation timestamp is too far ahead of the server"),
 	}
 }
@@ -0,0 +1,176 @@
+package presenters
+
+import (
+	"context"
+	sync_proto "github.com/Gregmus2/sync-proto-gen/go/sync"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/Gregmus2/sync-service/internal/groupproto"
+	"github.com/Gregmus2/sync-service/internal/interceptors"
+	"github.com/Gregmus2/sync-service/internal/logic"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"time"
+)
+
+type Groups struct {
+	service logic.Service
+}
+
+func NewGroupAPI(service logic.Service) groupproto.GroupServiceServer {
+	return &Groups{
+		service: service,
+	}
+}
+
+func (g Groups) CreateInvite(ctx context.Context, request *groupproto.CreateInviteRequest) (*groupproto.Invite, error) {
+	deviceToken := ctx.Value(interceptors.ContextDeviceToken).(string)
+	firebaseID := ctx.Value(interceptors.ContextFirebaseID).(string)
+
+	if request.GetTtlSeconds() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "ttl_seconds must not be negative")
+	}
+
+	ttl := time.Duration(request.GetTtlSeconds()) * time.Second
+	invite, err := g.service.CreateInvite(deviceToken, firebaseID, ttl, request.GetSingleUse(), request.GetRole())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create invite")
+	}
+
+	return inviteMessage(invite), nil
+}
+
+func (g Groups) GetInvites(ctx context.Context, _ *emptypb.Empty) (*groupproto.Invites, error) {
+	deviceToken := ctx.Value(interceptors.ContextDeviceToken).(string)
+	firebaseID := ctx.Value(interceptors.ContextFirebaseID).(string)
+
+	invites, err := g.service.GetInvites(deviceToken, firebaseID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get invites")
+	}
+
+	message := &groupproto.Invites{Invites: make([]*groupproto.Invite, 0, len(invites))}
+	for i := range invites {
+		message.Invites = append(message.Invites, inviteMessage(&invites[i]))
+	}
+
+	return message, nil
+}
+
+func (g Groups) RevokeInvite(ctx context.Context, request *groupproto.RevokeInviteRequest) (*emptypb.Empty, error) {
+	deviceToken := ctx.Value(interceptors.ContextDeviceToken).(string)
+	firebaseID := ctx.Value(interceptors.ContextFirebaseID).(string)
+
+	if err := g.service.RevokeInvite(deviceToken, firebaseID, request.GetCode()); err != nil {
+		return nil, errors.Wrap(err, "failed to revoke invite")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (g Groups) SetMemberRole(ctx context.Context, request *groupproto.SetMemberRoleRequest) (*emptypb.Empty, error) {
+	deviceToken := ctx.Value(interceptors.ContextDeviceToken).(string)
+	firebaseID := ctx.Value(interceptors.ContextFirebaseID).(string)
+
+	if err := g.service.SetMemberRole(ctx, deviceToken, firebaseID, request.GetMemberId(), request.GetRole()); err != nil {
+		return nil, errors.Wrap(err, "failed to set member role")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (g Groups) ListMembers(ctx context.Context, _ *emptypb.Empty) (*groupproto.Members, error) {
+	deviceToken := ctx.Value(interceptors.ContextDeviceToken).(string)
+	firebaseID := ctx.Value(interceptors.ContextFirebaseID).(string)
+
+	members, err := g.service.ListMembers(deviceToken, firebaseID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list members")
+	}
+
+	message := &groupproto.Members{Members: make([]*groupproto.Member, 0, len(members))}
+	for _, member := range members {
+		devices := make([]*groupproto.MemberDevice, 0, len(member.Devices))
+		for _, device := range member.Devices {
+			devices = append(devices, &groupproto.MemberDevice{
+				DeviceToken: device.DeviceToken,
+				LastSync:    device.LastSync,
+			})
+		}
+
+		message.Members = append(message.Members, &groupproto.Member{
+			UserId:   member.UserId,
+			Role:     member.Role,
+			JoinedAt: member.JoinedAt,
+			Devices:  devices,
+		})
+	}
+
+	return message, nil
+}
+
+func (g Groups) RemoveMember(ctx context.Context, request *groupproto.RemoveMemberRequest) (*emptypb.Empty, error) {
+	deviceToken := ctx.Value(interceptors.ContextDeviceToken).(string)
+	firebaseID := ctx.Value(interceptors.ContextFirebaseID).(string)
+
+	if err := g.service.RemoveMember(ctx, deviceToken, firebaseID, request.GetMemberId()); err != nil {
+		return nil, errors.Wrap(err, "failed to remove member")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (g Groups) TransferOwnership(ctx context.Context, request *groupproto.TransferOwnershipRequest) (*emptypb.Empty, error) {
+	deviceToken := ctx.Value(interceptors.ContextDeviceToken).(string)
+	firebaseID := ctx.Value(interceptors.ContextFirebaseID).(string)
+
+	if err := g.service.TransferOwnership(ctx, deviceToken, firebaseID, request.GetMemberId()); err != nil {
+		return nil, errors.Wrap(err, "failed to transfer ownership")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// Subscribe pushes operations other devices commit to the group until the client closes the stream. It ends once the
+// device moves to another group, the client subscribes again then.
+func (g Groups) Subscribe(_ *emptypb.Empty, stream groupproto.GroupService_SubscribeServer) error {
+	deviceToken := stream.Context().Value(interceptors.ContextDeviceToken).(string)
+	firebaseID := stream.Context().Value(interceptors.ContextFirebaseID).(string)
+
+	if err := g.service.Subscribe(deviceToken, firebaseID, subscriber{stream}); err != nil {
+		return errors.Wrap(err, "failed to subscribe")
+	}
+
+	return nil
+}
+
+// subscriber sends the pushed operations as the PushedOperations message of the stream.
+type subscriber struct {
+	groupproto.GroupService_SubscribeServer
+}
+
+func (s subscriber) Send(operations *sync_proto.SimpleOperations) error {
+	message := &groupproto.PushedOperations{Operations: make([]*groupproto.PushedOperation, 0, len(operations.Operations))}
+	for _, operation := range operations.Operations {
+		message.Operations = append(message.Operations, &groupproto.PushedOperation{
+			Sql:  operation.Sql,
+			Args: operation.Args,
+		})
+	}
+
+	return s.GroupService_SubscribeServer.Send(message)
+}
+
+// inviteMessage keeps times in unix microseconds like the rest of the api.
+func inviteMessage(invite *common.Invite) *groupproto.Invite {
+	return &groupproto.Invite{
+		Code:      invite.Code,
+		GroupId:   invite.GroupId,
+		CreatedBy: invite.CreatedBy,
+		CreatedAt: invite.CreatedAt,
+		ExpiresAt: invite.ExpiresAt,
+		SingleUse: invite.SingleUse,
+		Role:      invite.Role,
+	}
+}
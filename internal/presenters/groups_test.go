@@ -0,0 +1,172 @@
+package presenters
+
+import (
+	"context"
+	sync_proto "github.com/Gregmus2/sync-proto-gen/go/sync"
+	"github.com/Gregmus2/sync-service/internal/common"
+	"github.com/Gregmus2/sync-service/internal/groupproto"
+	"github.com/Gregmus2/sync-service/internal/interceptors"
+	"github.com/Gregmus2/sync-service/internal/logic"
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// testService implements the invite and member methods of logic.Service
+type testService struct {
+	logic.Service
+
+	invites map[string]common.Invite
+}
+
+func (s *testService) CreateInvite(deviceToken, userID string, ttl time.Duration, singleUse bool, role string) (*common.Invite, error) {
+	invite := common.Invite{
+		Code:      "CODE",
+		GroupId:   deviceToken + "-" + userID,
+		CreatedBy: userID,
+		CreatedAt: 1_700_000_000_000_000,
+		ExpiresAt: 1_700_000_000_000_000 + ttl.Microseconds(),
+		SingleUse: singleUse,
+		Role:      role,
+	}
+	s.invites[invite.Code] = invite
+
+	return &invite, nil
+}
+
+func (s *testService) GetInvites(string, string) ([]common.Invite, error) {
+	invites := make([]common.Invite, 0, len(s.invites))
+	for _, invite := range s.invites {
+		invites = append(invites, invite)
+	}
+
+	return invites, nil
+}
+
+func (s *testService) RevokeInvite(_, _, code string) error {
+	if _, ok := s.invites[code]; !ok {
+		return logic.ErrInviteNotFound
+	}
+	delete(s.invites, code)
+
+	return nil
+}
+
+func (s *testService) ListMembers(deviceToken, userID string) ([]common.MemberDevices, error) {
+	return []common.MemberDevices{{
+		UserId:   userID,
+		Role:     common.RoleOwner,
+		JoinedAt: 1,
+		Devices:  []common.DeviceToken{{DeviceToken: deviceToken, UserId: userID, LastSync: 2}},
+	}}, nil
+}
+
+func (s *testService) Subscribe(_, _ string, stream logic.Subscriber) error {
+	return stream.Send(&sync_proto.SimpleOperations{Operations: []*sync_proto.SimpleOperation{{Sql: "INSERT INTO notes VALUES (?)", Args: "[1]"}}})
+}
+
+// dialGroupService serves GroupService over an in-memory connection, the interceptor stands in for the
+// authorization and device token interceptors.
+func dialGroupService(t *testing.T, service logic.Service) *grpc.ClientConn {
+	t.Helper()
+
+	identity := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx = context.WithValue(ctx, interceptors.ContextDeviceToken, "phone")
+		ctx = context.WithValue(ctx, interceptors.ContextFirebaseID, "alice")
+
+		return handler(ctx, req)
+	}
+
+	streamIdentity := func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = context.WithValue(wrapped.WrappedContext, interceptors.ContextDeviceToken, "phone")
+		wrapped.WrappedContext = context.WithValue(wrapped.WrappedContext, interceptors.ContextFirebaseID, "alice")
+
+		return handler(srv, wrapped)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnaryInterceptor(identity), grpc.StreamInterceptor(streamIdentity))
+	server.RegisterService(&groupproto.GroupService_ServiceDesc, NewGroupAPI(service))
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func TestGroupServiceInvites(t *testing.T) {
+	client := groupproto.NewGroupServiceClient(dialGroupService(t, &testService{invites: make(map[string]common.Invite)}))
+	ctx := context.Background()
+
+	invite, err := client.CreateInvite(ctx, &groupproto.CreateInviteRequest{TtlSeconds: 60, SingleUse: true, Role: common.RoleViewer})
+	require.NoError(t, err)
+	assert.Equal(t, "CODE", invite.Code)
+	assert.Equal(t, "phone-alice", invite.GroupId)
+	assert.Equal(t, "alice", invite.CreatedBy)
+	assert.Equal(t, int64(1_700_000_000_000_000), invite.CreatedAt)
+	assert.Equal(t, int64(1_700_000_060_000_000), invite.ExpiresAt)
+	assert.True(t, invite.SingleUse)
+	assert.Equal(t, common.RoleViewer, invite.Role)
+
+	invites, err := client.GetInvites(ctx, &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Len(t, invites.Invites, 1)
+	assert.Equal(t, "CODE", invites.Invites[0].Code)
+
+	_, err = client.RevokeInvite(ctx, &groupproto.RevokeInviteRequest{Code: "CODE"})
+	require.NoError(t, err)
+	_, err = client.RevokeInvite(ctx, &groupproto.RevokeInviteRequest{Code: "CODE"})
+	assert.Error(t, err)
+
+	_, err = client.CreateInvite(ctx, &groupproto.CreateInviteRequest{TtlSeconds: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGroupServiceListMembers(t *testing.T) {
+	client := groupproto.NewGroupServiceClient(dialGroupService(t, &testService{}))
+
+	members, err := client.ListMembers(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Len(t, members.Members, 1)
+
+	member := members.Members[0]
+	assert.Equal(t, "alice", member.UserId)
+	assert.Equal(t, common.RoleOwner, member.Role)
+	assert.Equal(t, int64(1), member.JoinedAt)
+	require.Len(t, member.Devices, 1)
+	assert.Equal(t, "phone", member.Devices[0].DeviceToken)
+	assert.Equal(t, int64(2), member.Devices[0].LastSync)
+}
+
+func TestGroupServiceSubscribe(t *testing.T) {
+	client := groupproto.NewGroupServiceClient(dialGroupService(t, &testService{}))
+
+	stream, err := client.Subscribe(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+
+	operations, err := stream.Recv()
+	require.NoError(t, err)
+	require.Len(t, operations.Operations, 1)
+	assert.Equal(t, "INSERT INTO notes VALUES (?)", operations.Operations[0].Sql)
+	assert.Equal(t, "[1]", operations.Operations[0].Args)
+
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
@@ -7,9 +7,14 @@ import (
 	"github.com/Gregmus2/sync-service/internal/interceptors"
 	"github.com/Gregmus2/sync-service/internal/logic"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"strconv"
 )
 
+// cursorTrailerName carries the device cursor after SyncData and JoinGroup
+const cursorTrailerName = "sync-cursor"
+
 type Public struct {
 	sync_proto.UnimplementedSyncServiceServer
 
@@ -28,11 +33,13 @@ func (p Public) SyncData(stream sync_proto.SyncService_SyncDataServer) error {
 	deviceToken := stream.Context().Value(interceptors.ContextDeviceToken).(string)
 	firebaseID := stream.Context().Value(interceptors.ContextFirebaseID).(string)
 
-	err := p.service.SyncData(deviceToken, firebaseID, stream)
+	cursor, err := p.service.SyncData(deviceToken, firebaseID, stream)
 	if err != nil {
 		return errors.Wrap(err, "failed to sync data")
 	}
 
+	stream.SetTrailer(cursorTrailer(cursor))
+
 	return nil
 }
 
@@ -40,11 +47,14 @@ func (p Public) JoinGroup(request *sync_proto.JoinGroupRequest, stream sync_prot
 	deviceToken := stream.Context().Value(interceptors.ContextDeviceToken).(string)
 	firebaseID := stream.Context().Value(interceptors.ContextFirebaseID).(string)
 
-	err := p.service.JoinGroup(deviceToken, firebaseID, request.Group, request.MergeData, stream)
+	// the group field carries an invite code, or a group id while LegacyGroupJoin is on
+	cursor, err := p.service.JoinGroup(deviceToken, firebaseID, request.Group, request.MergeData, stream)
 	if err != nil {
 		return errors.Wrap(err, "failed to join group")
 	}
 
+	stream.SetTrailer(cursorTrailer(cursor))
+
 	return nil
 }
 
@@ -52,7 +62,7 @@ func (p Public) LeaveGroup(ctx context.Context, request *sync_proto.LeaveGroupRe
 	deviceToken := ctx.Value(interceptors.ContextDeviceToken).(string)
 	firebaseID := ctx.Value(interceptors.ContextFirebaseID).(string)
 
-	err := p.service.LeaveGroup(deviceToken, firebaseID, request.CopyData)
+	err := p.service.LeaveGroup(ctx, deviceToken, firebaseID, request.CopyData)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to leave group")
 	}
@@ -71,3 +81,7 @@ func (p Public) GetCurrentGroup(ctx context.Context, _ *emptypb.Empty) (*sync_pr
 
 	return &sync_proto.GetCurrentGroupResponse{Group: groupID}, nil
 }
+
+func cursorTrailer(cursor int64) metadata.MD {
+	return metadata.Pairs(cursorTrailerName, strconv.FormatInt(cursor, 10))
+}